@@ -0,0 +1,218 @@
+// Package analytics считает риск-метрики торгового журнала по упорядоченному списку сделок.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// PeriodsPerYear - число торговых дней в году для приведения Sharpe и Sortino к годовым.
+// Криптовалюты торгуются без выходных.
+const PeriodsPerYear = 365
+
+// Trade - результат закрытой сделки
+type Trade struct {
+	Date time.Time
+	PnL  float64
+}
+
+// Drawdown - самая глубокая просадка кривой капитала
+type Drawdown struct {
+	// Amount - просадка в деньгах от пика до дна
+	Amount float64
+	// Percent - просадка в процентах от капитала на пике
+	Percent float64
+	Peak    time.Time
+	Trough  time.Time
+	// Recovery - сделка, которой капитал вернулся к пику. Нулевое время - просадка не восстановлена
+	Recovery time.Time
+	// Duration - время от пика до восстановления или до последней сделки
+	Duration time.Duration
+}
+
+// Recovered сообщает, восстановился ли капитал после просадки
+func (d Drawdown) Recovered() bool {
+	return !d.Recovery.IsZero()
+}
+
+// sortedTrades возвращает копию сделок, отсортированную по дате
+func sortedTrades(trades []Trade) []Trade {
+	sorted := make([]Trade, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	return sorted
+}
+
+// EquityCurve возвращает капитал после каждой сделки
+func EquityCurve(start float64, trades []Trade) []float64 {
+	curve := make([]float64, 0, len(trades))
+	equity := start
+	for _, trade := range sortedTrades(trades) {
+		equity += trade.PnL
+		curve = append(curve, equity)
+	}
+
+	return curve
+}
+
+// MaxDrawdown находит самую глубокую просадку капитала от предыдущего пика
+func MaxDrawdown(start float64, trades []Trade) Drawdown {
+	trades = sortedTrades(trades)
+	if len(trades) == 0 {
+		return Drawdown{}
+	}
+
+	var result Drawdown
+
+	equity, peak := start, start
+	peakDate := trades[0].Date
+	// Пик самой глубокой просадки, по нему ищем восстановление
+	var maxPeak float64
+	recovering := false
+
+	for _, trade := range trades {
+		equity += trade.PnL
+
+		if equity >= peak {
+			if recovering && equity >= maxPeak {
+				result.Recovery = trade.Date
+				recovering = false
+			}
+			peak, peakDate = equity, trade.Date
+			continue
+		}
+
+		if amount := peak - equity; amount > result.Amount {
+			result = Drawdown{Amount: amount, Peak: peakDate, Trough: trade.Date}
+			if peak > 0 {
+				result.Percent = amount / peak * 100
+			}
+			maxPeak = peak
+			recovering = true
+		}
+	}
+
+	if result.Amount == 0 {
+		return Drawdown{}
+	}
+
+	end := trades[len(trades)-1].Date
+	if result.Recovered() {
+		end = result.Recovery
+	}
+	result.Duration = end.Sub(result.Peak)
+
+	return result
+}
+
+// RecoveryFactor - чистая прибыль, деленная на максимальную просадку. Без просадки возвращает 0
+func RecoveryFactor(start float64, trades []Trade) float64 {
+	drawdown := MaxDrawdown(start, trades)
+	if drawdown.Amount == 0 {
+		return 0
+	}
+
+	var net float64
+	for _, trade := range trades {
+		net += trade.PnL
+	}
+
+	return net / drawdown.Amount
+}
+
+// DailyReturns группирует сделки по календарным дням в часовом поясе loc и возвращает
+// доходность каждого дня от первого до последнего, дни без сделок дают нулевую доходность.
+// Если стартовый капитал не задан, возвращает дневной P&L в деньгах.
+func DailyReturns(start float64, trades []Trade, loc *time.Location) []float64 {
+	trades = sortedTrades(trades)
+	if len(trades) == 0 {
+		return nil
+	}
+
+	day := func(t time.Time) time.Time {
+		y, m, d := t.In(loc).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+
+	first, last := day(trades[0].Date), day(trades[len(trades)-1].Date)
+	days := int(last.Sub(first).Hours()/24+0.5) + 1
+
+	pnl := make([]float64, days)
+	for _, trade := range trades {
+		pnl[int(day(trade.Date).Sub(first).Hours()/24+0.5)] += trade.PnL
+	}
+
+	if start <= 0 {
+		return pnl
+	}
+
+	returns := make([]float64, days)
+	equity := start
+	for i, dayPnL := range pnl {
+		if equity > 0 {
+			returns[i] = dayPnL / equity
+		}
+		equity += dayPnL
+	}
+
+	return returns
+}
+
+func mean(xs []float64) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+
+	return sum / float64(len(xs))
+}
+
+// StdDev - выборочное стандартное отклонение
+func StdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+
+	m := mean(xs)
+	var sum float64
+	for _, x := range xs {
+		sum += (x - m) * (x - m)
+	}
+
+	return math.Sqrt(sum / float64(len(xs)-1))
+}
+
+// Sharpe - годовой коэффициент Шарпа по дневным доходностям с нулевой безрисковой ставкой
+func Sharpe(returns []float64) float64 {
+	sd := StdDev(returns)
+	if sd == 0 {
+		return 0
+	}
+
+	return mean(returns) / sd * math.Sqrt(PeriodsPerYear)
+}
+
+// Sortino - годовой коэффициент Сортино: как Шарп, но штрафует только отрицательную волатильность
+func Sortino(returns []float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, r := range returns {
+		if r < 0 {
+			sum += r * r
+		}
+	}
+
+	downside := math.Sqrt(sum / float64(len(returns)))
+	if downside == 0 {
+		return 0
+	}
+
+	return mean(returns) / downside * math.Sqrt(PeriodsPerYear)
+}
@@ -0,0 +1,264 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var day0 = time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func at(days int) time.Time {
+	return day0.AddDate(0, 0, days)
+}
+
+func trades(pnl ...float64) []Trade {
+	result := make([]Trade, len(pnl))
+	for i, p := range pnl {
+		result[i] = Trade{Date: at(i), PnL: p}
+	}
+
+	return result
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEquityCurve(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  float64
+		trades []Trade
+		want   []float64
+	}{
+		{name: "empty", start: 100, trades: nil, want: []float64{}},
+		{name: "growth", start: 100, trades: trades(10, -5, 20), want: []float64{110, 105, 125}},
+		{
+			name:   "unsorted input",
+			start:  0,
+			trades: []Trade{{Date: at(2), PnL: 3}, {Date: at(0), PnL: 1}, {Date: at(1), PnL: 2}},
+			want:   []float64{1, 3, 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EquityCurve(tt.start, tt.trades)
+			if len(got) != len(tt.want) {
+				t.Fatalf("len = %d, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !almostEqual(got[i], tt.want[i]) {
+					t.Errorf("curve[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  float64
+		trades []Trade
+		want   Drawdown
+	}{
+		{name: "no trades", start: 1000, trades: nil, want: Drawdown{}},
+		{name: "only wins", start: 1000, trades: trades(10, 20, 30), want: Drawdown{}},
+		{
+			name:   "recovered",
+			start:  1000,
+			trades: trades(100, -200, -100, 250, 50),
+			want: Drawdown{
+				Amount:   300,
+				Percent:  300.0 / 1100 * 100,
+				Peak:     at(0),
+				Trough:   at(2),
+				Recovery: at(4),
+				Duration: 4 * 24 * time.Hour,
+			},
+		},
+		{
+			name:   "not recovered",
+			start:  1000,
+			trades: trades(-100, 50, -200),
+			want: Drawdown{
+				Amount:   250,
+				Percent:  25,
+				Peak:     at(0),
+				Trough:   at(2),
+				Duration: 2 * 24 * time.Hour,
+			},
+		},
+		{
+			name:   "deepest of two",
+			start:  100,
+			trades: trades(-10, 20, -5, 10, -30),
+			want: Drawdown{
+				Amount:   30,
+				Percent:  30.0 / 115 * 100,
+				Peak:     at(3),
+				Trough:   at(4),
+				Duration: 24 * time.Hour,
+			},
+		},
+		{
+			name:   "zero start",
+			start:  0,
+			trades: trades(-50, 20),
+			want: Drawdown{
+				Amount:   50,
+				Peak:     at(0),
+				Trough:   at(0),
+				Duration: 24 * time.Hour,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MaxDrawdown(tt.start, tt.trades)
+			if !almostEqual(got.Amount, tt.want.Amount) || !almostEqual(got.Percent, tt.want.Percent) {
+				t.Errorf("drawdown = %v (%v%%), want %v (%v%%)", got.Amount, got.Percent, tt.want.Amount, tt.want.Percent)
+			}
+			if !got.Peak.Equal(tt.want.Peak) || !got.Trough.Equal(tt.want.Trough) || !got.Recovery.Equal(tt.want.Recovery) {
+				t.Errorf("dates = %v/%v/%v, want %v/%v/%v", got.Peak, got.Trough, got.Recovery, tt.want.Peak, tt.want.Trough, tt.want.Recovery)
+			}
+			if got.Duration != tt.want.Duration {
+				t.Errorf("duration = %v, want %v", got.Duration, tt.want.Duration)
+			}
+		})
+	}
+}
+
+func TestRecoveryFactor(t *testing.T) {
+	tests := []struct {
+		name   string
+		trades []Trade
+		want   float64
+	}{
+		{name: "no drawdown", trades: trades(10, 10), want: 0},
+		{name: "recovered", trades: trades(100, -200, -100, 250, 50), want: 100.0 / 300},
+		{name: "net loss", trades: trades(-100, 50), want: -0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RecoveryFactor(1000, tt.trades); !almostEqual(got, tt.want) {
+				t.Errorf("RecoveryFactor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDailyReturns(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  float64
+		trades []Trade
+		want   []float64
+	}{
+		{name: "empty", start: 100, trades: nil, want: nil},
+		{
+			name:   "same day grouped and gap filled",
+			start:  100,
+			trades: []Trade{{Date: at(0), PnL: 5}, {Date: at(0).Add(time.Hour), PnL: 5}, {Date: at(2), PnL: -11}},
+			want:   []float64{0.1, 0, -0.1},
+		},
+		{
+			name:   "absolute without capital",
+			start:  0,
+			trades: trades(5, -3),
+			want:   []float64{5, -3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DailyReturns(tt.start, tt.trades, time.UTC)
+			if len(got) != len(tt.want) {
+				t.Fatalf("len = %d, want %d (%v)", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !almostEqual(got[i], tt.want[i]) {
+					t.Errorf("returns[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDailyReturnsTimezone(t *testing.T) {
+	// 23:30 UTC уже следующий день по Москве
+	moscow := time.FixedZone("MSK", 3*60*60)
+	trades := []Trade{
+		{Date: time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC), PnL: 1},
+		{Date: time.Date(2024, 4, 1, 23, 30, 0, 0, time.UTC), PnL: 2},
+	}
+
+	if got := DailyReturns(0, trades, time.UTC); len(got) != 1 {
+		t.Errorf("UTC days = %d, want 1", len(got))
+	}
+	if got := DailyReturns(0, trades, moscow); len(got) != 2 {
+		t.Errorf("MSK days = %d, want 2", len(got))
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	tests := []struct {
+		name string
+		xs   []float64
+		want float64
+	}{
+		{name: "empty", xs: nil, want: 0},
+		{name: "single", xs: []float64{3}, want: 0},
+		{name: "constant", xs: []float64{2, 2, 2}, want: 0},
+		{name: "sample", xs: []float64{2, 4, 4, 4, 5, 5, 7, 9}, want: math.Sqrt(32.0 / 7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StdDev(tt.xs); !almostEqual(got, tt.want) {
+				t.Errorf("StdDev() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharpeSortino(t *testing.T) {
+	annual := math.Sqrt(PeriodsPerYear)
+
+	tests := []struct {
+		name        string
+		returns     []float64
+		wantSharpe  float64
+		wantSortino float64
+	}{
+		{name: "empty", returns: nil, wantSharpe: 0, wantSortino: 0},
+		{name: "no volatility", returns: []float64{0.01, 0.01}, wantSharpe: 0, wantSortino: 0},
+		{
+			name:        "mixed",
+			returns:     []float64{0.02, -0.01, 0.03, -0.02},
+			wantSharpe:  0.005 / StdDev([]float64{0.02, -0.01, 0.03, -0.02}) * annual,
+			wantSortino: 0.005 / math.Sqrt((0.0001+0.0004)/4) * annual,
+		},
+		{
+			name:        "only losses",
+			returns:     []float64{-0.01, -0.03},
+			wantSharpe:  -0.02 / StdDev([]float64{-0.01, -0.03}) * annual,
+			wantSortino: -0.02 / math.Sqrt((0.0001+0.0009)/2) * annual,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sharpe(tt.returns); !almostEqual(got, tt.wantSharpe) {
+				t.Errorf("Sharpe() = %v, want %v", got, tt.wantSharpe)
+			}
+			if got := Sortino(tt.returns); !almostEqual(got, tt.wantSortino) {
+				t.Errorf("Sortino() = %v, want %v", got, tt.wantSortino)
+			}
+		})
+	}
+}
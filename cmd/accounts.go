@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных торговых счетов
+const accountCallbackPrefix = "/account:"
+
+const maxAccountNameLength = 40
+
+// Мапа счетов, которые пользователь сейчас создает
+var usersPendingAccount = make(map[int64]*Account)
+
+// Мапа пополнений и выводов, сумму которых ждем от пользователя
+var usersPendingCashFlow = make(map[int64]*CashFlow)
+
+// accountSummary - состояние счета с учетом сделок и движения средств
+type accountSummary struct {
+	Account     *Account
+	Deposits    decimal.Decimal
+	Withdrawals decimal.Decimal
+	PnL         decimal.Decimal
+	Balance     decimal.Decimal
+	// Return - P&L в процентах от всех вложенных средств (стартовый баланс + пополнения)
+	Return decimal.Decimal
+	// TWR - доходность, взвешенная по времени, не зависящая от пополнений и выводов
+	TWR decimal.Decimal
+}
+
+// ledgerEvent - изменение баланса счета: результат сделки или движение средств
+type ledgerEvent struct {
+	Date     time.Time
+	Amount   decimal.Decimal
+	CashFlow bool
+}
+
+// summarizeAccount считает текущий баланс и доходность счета
+func summarizeAccount(account *Account, deals []*Deal, flows []*CashFlow) *accountSummary {
+	summary := &accountSummary{Account: account, Balance: account.StartingBalance}
+
+	var events []ledgerEvent
+	for _, deal := range deals {
+		if deal.AccountID != account.ID || deal.Open {
+			continue
+		}
+		summary.PnL = summary.PnL.Add(deal.Profit)
+		events = append(events, ledgerEvent{Date: deal.Date, Amount: deal.Profit})
+	}
+	for _, flow := range flows {
+		if flow.AccountID != account.ID {
+			continue
+		}
+		if flow.Amount.IsPositive() {
+			summary.Deposits = summary.Deposits.Add(flow.Amount)
+		} else {
+			summary.Withdrawals = summary.Withdrawals.Sub(flow.Amount)
+		}
+		events = append(events, ledgerEvent{Date: flow.Date, Amount: flow.Amount, CashFlow: true})
+	}
+
+	summary.Balance = account.StartingBalance.Add(summary.Deposits).Sub(summary.Withdrawals).Add(summary.PnL)
+
+	invested := account.StartingBalance.Add(summary.Deposits)
+	if invested.IsPositive() {
+		summary.Return = summary.PnL.Div(invested).Mul(decimal.NewFromInt(100)).Truncate(2)
+	}
+
+	summary.TWR = timeWeightedReturn(account.StartingBalance, events)
+
+	return summary
+}
+
+// timeWeightedReturn делит историю счета на периоды между пополнениями и выводами
+// и перемножает доходности периодов, поэтому движение средств не влияет на результат
+func timeWeightedReturn(start decimal.Decimal, events []ledgerEvent) decimal.Decimal {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+
+	growth := decimal.NewFromInt(1)
+	value, periodStart := start, start
+
+	for _, event := range events {
+		if !event.CashFlow {
+			value = value.Add(event.Amount)
+			continue
+		}
+
+		// Период с нулевым балансом не дает доходности
+		if periodStart.IsPositive() {
+			growth = growth.Mul(value.Div(periodStart))
+		}
+		value = value.Add(event.Amount)
+		periodStart = value
+	}
+	if periodStart.IsPositive() {
+		growth = growth.Mul(value.Div(periodStart))
+	}
+
+	return growth.Sub(decimal.NewFromInt(1)).Mul(decimal.NewFromInt(100)).Truncate(2)
+}
+
+// getAccountSummaries возвращает состояние всех счетов пользователя
+func getAccountSummaries(chatID int64) ([]*accountSummary, error) {
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil || len(accounts) == 0 {
+		return nil, err
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := Repository.getCashFlows(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*accountSummary, 0, len(accounts))
+	for _, account := range accounts {
+		summaries = append(summaries, summarizeAccount(account, deals, flows))
+	}
+
+	return summaries, nil
+}
+
+func (s *accountSummary) String() string {
+	return "<b>" + html.EscapeString(s.Account.Name) + "</b>: " + s.Balance.Truncate(3).String() + "$\n" +
+		"старт " + s.Account.StartingBalance.String() + "$, пополнения +" + s.Deposits.String() + "$, выводы -" + s.Withdrawals.String() + "$\n" +
+		"P&L " + s.PnL.Truncate(3).String() + "$, доходность " + s.Return.String() + "%, TWR " + s.TWR.String() + "%\n"
+}
+
+func buildAccountsText(summaries []*accountSummary) string {
+	var sb strings.Builder
+	var balance, pnl decimal.Decimal
+	for _, summary := range summaries {
+		sb.WriteString(summary.String())
+		balance = balance.Add(summary.Balance)
+		pnl = pnl.Add(summary.PnL)
+	}
+
+	if len(summaries) > 1 {
+		sb.WriteString("<b>Все портфели</b>: " + balance.Truncate(3).String() + "$, P&L " + pnl.Truncate(3).String() + "$\n")
+	}
+
+	return sb.String()
+}
+
+// currentAccount возвращает текущий портфель пользователя, nil - все портфели
+func currentAccount(chatID int64) (*Account, error) {
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil || user.CurrentAccountID == 0 {
+		return nil, err
+	}
+
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, account := range accounts {
+		if account.ID == user.CurrentAccountID {
+			return account, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// currentAccountID возвращает ID текущего портфеля, 0 - все портфели
+func currentAccountID(chatID int64) int64 {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		log.Println("Error getting current account: ", err)
+	}
+	if account == nil {
+		return 0
+	}
+
+	return account.ID
+}
+
+// accountLabel - подпись текущего портфеля для кнопок и заголовков
+func accountLabel(account *Account) string {
+	if account == nil {
+		return "все портфели"
+	}
+
+	return account.Name
+}
+
+func askAccountSwitch(ctx context.Context, b *bot.Bot, chatID int64) {
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil {
+		log.Println("Error getting accounts: ", err)
+		return
+	}
+
+	if len(accounts) == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "У вас пока нет портфелей. Создайте счет, и он станет портфелем.",
+			ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: "Новый счет", CallbackData: accountCallbackPrefix + "add"}},
+			}},
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	current := currentAccountID(chatID)
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, account := range append([]*Account{{Name: "Все портфели"}}, accounts...) {
+		mark := ""
+		if account.ID == current {
+			mark = "✅ "
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: mark + account.Name, CallbackData: accountCallbackPrefix + "use:" + strconv.FormatInt(account.ID, 10)}})
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Выберите портфель. Новые сделки, история и статистика будут относиться к нему.",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func accountsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	summaries, err := getAccountSummaries(chatID)
+	if err != nil {
+		log.Println("Error getting accounts: ", err)
+		return
+	}
+
+	text := "<b>Счета 🏦</b>\n"
+	if len(summaries) == 0 {
+		text += "У вас пока нет счетов. Создайте счет, чтобы следить за балансом и доходностью."
+	} else {
+		text += buildAccountsText(summaries)
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, summary := range summaries {
+		id := strconv.FormatInt(summary.Account.ID, 10)
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: "➕ " + summary.Account.Name, CallbackData: accountCallbackPrefix + "deposit:" + id},
+			{Text: "➖ " + summary.Account.Name, CallbackData: accountCallbackPrefix + "withdraw:" + id},
+		})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Новый счет", CallbackData: accountCallbackPrefix + "add"}})
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+// askDealAccount привязывает новую сделку к счету. Единственный счет или текущий портфель
+// выбираются сами, спрашиваем только в режиме "все портфели".
+func askDealAccount(ctx context.Context, b *bot.Bot, chatID int64) {
+	deal := usersPendingDeal[chatID]
+	if deal == nil {
+		return
+	}
+
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil {
+		log.Println("Error getting accounts: ", err)
+	}
+
+	if len(accounts) == 1 {
+		deal.AccountID = accounts[0].ID
+	}
+	if deal.AccountID == 0 {
+		deal.AccountID = currentAccountID(chatID)
+	}
+	if len(accounts) <= 1 || deal.AccountID != 0 {
+		askDealStrategy(ctx, b, chatID)
+		return
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, account := range accounts {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: account.Name, CallbackData: accountCallbackPrefix + "pick:" + strconv.FormatInt(account.ID, 10)}})
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "На каком счете сделка?",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateIdle
+}
+
+func accountCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, accountCallbackPrefix), ":")
+
+	if action == "add" {
+		usersPendingAccount[chatID] = &Account{}
+		sendAccountPrompt(ctx, b, chatID, "Введите название счета (напр. Binance или Демо):", StateAwaitingAccountName)
+		return
+	}
+
+	if action == "switch" {
+		askAccountSwitch(ctx, b, chatID)
+		return
+	}
+
+	accountID, err := strconv.ParseInt(args, 10, 64)
+	if err != nil {
+		log.Println("invalid account id ", args)
+		return
+	}
+
+	switch action {
+	case "pick":
+		deal := usersPendingDeal[chatID]
+		if deal == nil {
+			return
+		}
+		deal.AccountID = accountID
+		askDealStrategy(ctx, b, chatID)
+	case "use":
+		if err := Repository.setCurrentAccount(chatID, accountID); err != nil {
+			log.Println("Error switching account: ", err)
+			return
+		}
+		delete(usersHistoryFilter, chatID)
+
+		account, err := currentAccount(chatID)
+		if err != nil {
+			log.Println("Error getting current account: ", err)
+		}
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Текущий портфель: " + accountLabel(account),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+
+		if err := showStandardButtons(ctx, b, update); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+	case "deposit":
+		usersPendingCashFlow[chatID] = &CashFlow{AccountID: accountID}
+		sendAccountPrompt(ctx, b, chatID, "Введите сумму пополнения:", StateAwaitingCashFlow)
+	case "withdraw":
+		// Отрицательная единица помечает вывод до ввода суммы
+		usersPendingCashFlow[chatID] = &CashFlow{AccountID: accountID, Amount: decimal.NewFromInt(-1)}
+		sendAccountPrompt(ctx, b, chatID, "Введите сумму вывода:", StateAwaitingCashFlow)
+	}
+}
+
+func sendAccountPrompt(ctx context.Context, b *bot.Bot, chatID int64, text string, state UserState) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = state
+	log.Printf("update user %v state for %v  ", chatID, state)
+}
+
+func sendAccountError(ctx context.Context, b *bot.Bot, chatID int64, err error) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   err.Error(),
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func handleAccountName(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	account := usersPendingAccount[chatID]
+	if chatID == 0 || update.Message == nil || account == nil {
+		return
+	}
+
+	name := strings.TrimSpace(update.Message.Text)
+	if name == "" || len([]rune(name)) > maxAccountNameLength {
+		sendAccountError(ctx, b, chatID, fmt.Errorf("название счета должно быть от 1 до %d символов", maxAccountNameLength))
+		return
+	}
+	account.Name = name
+
+	sendAccountPrompt(ctx, b, chatID, "Укажите стартовый баланс счета:", StateAwaitingAccountBalance)
+}
+
+func handleAccountBalance(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	account := usersPendingAccount[chatID]
+	if chatID == 0 || update.Message == nil || account == nil {
+		return
+	}
+
+	balance, err := validatePrice(update.Message.Text)
+	if err != nil {
+		sendAccountError(ctx, b, chatID, err)
+		return
+	}
+	account.StartingBalance = balance
+	account.CreatedAt = time.Now().UTC()
+
+	delete(usersPendingAccount, chatID)
+	usersStates[chatID] = StateIdle
+
+	text := "Счет " + account.Name + " создан ✅"
+	if err := Repository.createAccount(chatID, account); err != nil {
+		log.Println("Error creating account: ", err)
+		text = "Ошибка создания счета. Возможно, счет с таким названием уже есть."
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+
+	if err := showStandardButtons(ctx, b, update); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func handleCashFlow(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	flow := usersPendingCashFlow[chatID]
+	if chatID == 0 || update.Message == nil || flow == nil {
+		return
+	}
+
+	amount, err := validatePrice(update.Message.Text)
+	if err == nil && !amount.IsPositive() {
+		err = fmt.Errorf("сумма должна быть больше нуля")
+	}
+	if err != nil {
+		sendAccountError(ctx, b, chatID, err)
+		return
+	}
+
+	withdrawal := flow.Amount.IsNegative()
+	if withdrawal {
+		summaries, err := getAccountSummaries(chatID)
+		if err != nil {
+			log.Println("Error getting accounts: ", err)
+			return
+		}
+		for _, summary := range summaries {
+			if summary.Account.ID == flow.AccountID && amount.GreaterThan(summary.Balance) {
+				sendAccountError(ctx, b, chatID, fmt.Errorf("на счете только %s$", summary.Balance.Truncate(3).String()))
+				return
+			}
+		}
+		amount = amount.Neg()
+	}
+	flow.Amount = amount
+	flow.Date = time.Now().UTC()
+
+	delete(usersPendingCashFlow, chatID)
+	usersStates[chatID] = StateIdle
+
+	text := "Пополнение сохранено ✅"
+	if withdrawal {
+		text = "Вывод сохранен ✅"
+	}
+	if err := Repository.saveCashFlow(chatID, flow); err != nil {
+		log.Println("Error saving cash flow: ", err)
+		text = "Ошибка сохранения операции"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+
+	accountsCommand(ctx, b, update)
+}
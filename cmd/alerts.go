@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных ценовых уведомлений
+const alertCallbackPrefix = "/alert:"
+
+// Как часто проверяются цены для уведомлений
+const alertsInterval = 30 * time.Second
+
+const alertUsage = "Пример: /alert BTC/USD > 70000 или /alert ETH/USD < 3000\n/alerts - список уведомлений"
+
+var alertSigns = map[AlertDirection]string{
+	AlertAbove: ">",
+	AlertBelow: "<",
+}
+
+// parseAlert разбирает условие уведомления: "BTC/USD > 70000", "eth/usd<=3000"
+func parseAlert(text string) (*PriceAlert, error) {
+	i := strings.IndexAny(text, "<>")
+	if i < 0 {
+		return nil, fmt.Errorf("не понял условие. %s", alertUsage)
+	}
+
+	alert := &PriceAlert{Pair: normalizePair(text[:i]), Direction: AlertAbove}
+	if text[i] == '<' {
+		alert.Direction = AlertBelow
+	}
+	if err := validatePair(alert.Pair); err != nil {
+		return nil, fmt.Errorf("укажите пару. %s", alertUsage)
+	}
+
+	level, err := decimal.NewFromString(strings.TrimSpace(strings.TrimPrefix(text[i+1:], "=")))
+	if err != nil || !level.IsPositive() {
+		return nil, fmt.Errorf("уровень должен быть положительным числом. %s", alertUsage)
+	}
+	alert.Level = level
+
+	return alert, nil
+}
+
+// reached проверяет, дошла ли цена до уровня уведомления
+func (a *PriceAlert) reached(price decimal.Decimal) bool {
+	if a.Direction == AlertBelow {
+		return price.LessThanOrEqual(a.Level)
+	}
+
+	return price.GreaterThanOrEqual(a.Level)
+}
+
+func (a *PriceAlert) String() string {
+	return a.Pair + " " + alertSigns[a.Direction] + " " + a.Level.String()
+}
+
+// alertCommand обрабатывает /alert с условием и /alerts со списком уведомлений
+func alertCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	command, args, _ := strings.Cut(strings.TrimSpace(update.Message.Text), " ")
+	args = strings.TrimSpace(args)
+
+	if command == "/alerts" || args == "" {
+		showAlerts(ctx, b, chatID, 0)
+		return
+	}
+	if command != "/alert" {
+		return
+	}
+
+	alert, err := parseAlert(args)
+	if err == nil {
+		err = addAlert(ctx, chatID, alert)
+	}
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Уведомление создано: " + alert.String(),
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+// addAlert сохраняет уведомление, если цена пары известна и уровень еще не пересечен
+func addAlert(ctx context.Context, chatID int64, alert *PriceAlert) error {
+	if Prices == nil {
+		return fmt.Errorf("источник цен не настроен, уведомления недоступны")
+	}
+
+	prices, err := Prices.Prices(ctx, []string{alert.Pair})
+	if err != nil {
+		log.Println("Error getting prices: ", err)
+		return fmt.Errorf("не удалось получить цену, попробуйте позже")
+	}
+
+	price, ok := prices[alert.Pair]
+	if !ok {
+		return fmt.Errorf("нет цены для пары %s", alert.Pair)
+	}
+	if alert.reached(price) {
+		return fmt.Errorf("цена %s уже %s %s", alert.Pair, alertSigns[alert.Direction], price.String())
+	}
+
+	alert.UserID = chatID
+	alert.CreatedAt = time.Now().UTC()
+	if err := Repository.savePriceAlert(alert); err != nil {
+		log.Println("Error saving price alert: ", err)
+		return fmt.Errorf("ошибка сохранения уведомления")
+	}
+
+	return nil
+}
+
+// showAlerts отправляет список уведомлений новым сообщением или,
+// если передан messageID, редактирует уже показанный список.
+func showAlerts(ctx context.Context, b *bot.Bot, chatID int64, messageID int) {
+	alerts, err := Repository.getPriceAlerts(chatID)
+	if err != nil {
+		log.Println("Error getting price alerts: ", err)
+		return
+	}
+
+	loc := getUserLocation(chatID)
+
+	var sb strings.Builder
+	sb.WriteString("<b>Ценовые уведомления 🔔</b>\n\n")
+	if len(alerts) == 0 {
+		sb.WriteString("Уведомлений нет\n\n")
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{}
+	for i, alert := range alerts {
+		n := strconv.Itoa(i + 1)
+		sb.WriteString(n + ". " + html.EscapeString(alert.String()) + " (с " + formatDateTime(alert.CreatedAt, loc) + ")\n")
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "❌ Удалить " + n, CallbackData: alertCallbackPrefix + "remove:" + strconv.FormatInt(alert.ID, 10)}})
+	}
+	if len(alerts) > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(html.EscapeString(alertUsage))
+
+	if messageID == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        sb.String(),
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		Text:        sb.String(),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Printf("can't edit message for %v, error: %v", chatID, err)
+	}
+}
+
+func alertCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, alertCallbackPrefix), ":")
+
+	switch action {
+	case "remove":
+		alertID, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid alert id ", args)
+			return
+		}
+
+		if err := Repository.deletePriceAlert(chatID, alertID); err != nil {
+			log.Println("Error deleting price alert: ", err)
+			return
+		}
+
+		showAlerts(ctx, b, chatID, getMessageID(update))
+	}
+}
+
+// runAlerts периодически сверяет активные уведомления с ценами и завершается вместе с ctx
+func runAlerts(ctx context.Context, b *bot.Bot, source PriceSource) {
+	ticker := time.NewTicker(alertsInterval)
+	defer ticker.Stop()
+
+	for {
+		checkPriceAlerts(ctx, b, source)
+
+		select {
+		case <-ctx.Done():
+			log.Println("alerts worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkPriceAlerts(ctx context.Context, b *bot.Bot, source PriceSource) {
+	alerts, err := Repository.getActivePriceAlerts()
+	if err != nil {
+		log.Println("Error getting price alerts: ", err)
+		return
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	// Одна выборка цен на все пары, сколько бы уведомлений на них ни было
+	var pairs []string
+	seen := make(map[string]bool)
+	for _, alert := range alerts {
+		if !seen[alert.Pair] {
+			seen[alert.Pair] = true
+			pairs = append(pairs, alert.Pair)
+		}
+	}
+
+	prices, err := source.Prices(ctx, pairs)
+	if err != nil {
+		log.Println("Error getting prices: ", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		price, ok := prices[alert.Pair]
+		if !ok || !alert.reached(price) {
+			continue
+		}
+
+		triggered, err := Repository.triggerPriceAlert(alert.ID, time.Now())
+		if err != nil {
+			log.Println("Error saving price alert: ", err)
+			continue
+		}
+		if !triggered {
+			continue
+		}
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    alert.UserID,
+			Text:      "🔔 <b>" + html.EscapeString(alert.String()) + "</b>\nТекущая цена: " + price.String(),
+			ParseMode: models.ParseModeHTML,
+		}); err != nil {
+			log.Printf("can't send alert to %v, error: %v", alert.UserID, err)
+		}
+	}
+}
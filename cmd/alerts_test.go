@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseAlert(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		pair      string
+		direction AlertDirection
+		level     string
+		wantErr   bool
+	}{
+		{name: "above", text: "BTC/USD > 70000", pair: "BTC/USD", direction: AlertAbove, level: "70000"},
+		{name: "below", text: "ETH/USD < 3000.5", pair: "ETH/USD", direction: AlertBelow, level: "3000.5"},
+		{name: "below or equal", text: "eth/usd<=3000", pair: "ETH/USD", direction: AlertBelow, level: "3000"},
+		{name: "above or equal", text: " sol/usdt >= 150 ", pair: "SOL/USDT", direction: AlertAbove, level: "150"},
+		{name: "no sign", text: "BTC/USD 70000", wantErr: true},
+		{name: "no pair", text: "> 70000", wantErr: true},
+		{name: "pair too long", text: "VERYLONGPAIRNAME/USDT > 1", wantErr: true},
+		{name: "level not a number", text: "BTC/USD > много", wantErr: true},
+		{name: "empty level", text: "BTC/USD >", wantErr: true},
+		{name: "zero level", text: "BTC/USD > 0", wantErr: true},
+		{name: "negative level", text: "BTC/USD < -5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert, err := parseAlert(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAlert(%q) = %v, want error", tt.text, alert)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAlert(%q) error: %v", tt.text, err)
+			}
+			if alert.Pair != tt.pair {
+				t.Errorf("pair = %q, want %q", alert.Pair, tt.pair)
+			}
+			if alert.Direction != tt.direction {
+				t.Errorf("direction = %v, want %v", alert.Direction, tt.direction)
+			}
+			if !alert.Level.Equal(decimal.RequireFromString(tt.level)) {
+				t.Errorf("level = %v, want %v", alert.Level, tt.level)
+			}
+		})
+	}
+}
+
+func TestPriceAlertReached(t *testing.T) {
+	level := decimal.NewFromInt(100)
+
+	tests := []struct {
+		name      string
+		direction AlertDirection
+		price     string
+		want      bool
+	}{
+		{name: "above not reached", direction: AlertAbove, price: "99.99", want: false},
+		{name: "above touched", direction: AlertAbove, price: "100", want: true},
+		{name: "above crossed", direction: AlertAbove, price: "101", want: true},
+		{name: "below not reached", direction: AlertBelow, price: "100.01", want: false},
+		{name: "below touched", direction: AlertBelow, price: "100", want: true},
+		{name: "below crossed", direction: AlertBelow, price: "99", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &PriceAlert{Pair: "BTC/USD", Direction: tt.direction, Level: level}
+			if got := alert.reached(decimal.RequireFromString(tt.price)); got != tt.want {
+				t.Errorf("reached(%s) = %v, want %v", tt.price, got, tt.want)
+			}
+		})
+	}
+}
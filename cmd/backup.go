@@ -0,0 +1,693 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Версия формата резервной копии, увеличивается при несовместимых изменениях
+const backupVersion = 1
+
+// Telegram отдает ботам файлы не больше 20 МБ
+const maxBackupSize = 20 << 20
+
+const restoreCallbackPrefix = "/restore:"
+
+// restoreMode - что делать с записями архива, которые уже есть в журнале
+type restoreMode string
+
+const (
+	// restoreSkip оставляет совпадающие записи как есть и добавляет только новые
+	restoreSkip restoreMode = "skip"
+	// restoreOverwrite заменяет совпадающие записи и настройки данными из архива
+	restoreOverwrite restoreMode = "overwrite"
+	// restoreDuplicate добавляет записи архива рядом с совпадающими
+	restoreDuplicate restoreMode = "duplicate"
+)
+
+var restoreModeNames = map[restoreMode]string{
+	restoreSkip:      "Пропустить совпадающие",
+	restoreOverwrite: "Перезаписать",
+	restoreDuplicate: "Добавить копии",
+}
+
+// Загруженные архивы, для которых пользователь еще не выбрал способ восстановления
+var usersPendingRestore = make(map[int64]*backupArchive)
+
+// backupArchive - резервная копия журнала пользователя. Записи ссылаются друг на друга
+// идентификаторами исходной базы, при восстановлении они заменяются новыми
+type backupArchive struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Бот, в котором сделана копия: file_id вложений действительны только в нем
+	BotID      int64             `json:"bot_id"`
+	Settings   backupSettings    `json:"settings"`
+	Pairs      []string          `json:"pairs"`
+	Accounts   []*backupAccount  `json:"accounts"`
+	Strategies []*backupStrategy `json:"strategies"`
+	Tags       []string          `json:"tags"`
+	Deals      []*backupDeal     `json:"deals"`
+	Breaches   []*backupBreach   `json:"limit_breaches"`
+	Alerts     []*backupAlert    `json:"price_alerts"`
+}
+
+// backupSettings - настройки пользователя, нулевые значения означают, что настройка не задана
+type backupSettings struct {
+	Name                 string          `json:"name"`
+	ChatID               int64           `json:"chat_id"`
+	HistoryPageSize      int             `json:"history_page_size"`
+	Balance              decimal.Decimal `json:"balance"`
+	CurrentAccountID     int64           `json:"current_account_id,omitempty"`
+	MaxDailyLoss         decimal.Decimal `json:"max_daily_loss"`
+	MaxDailyTrades       int             `json:"max_daily_trades"`
+	MaxConsecutiveLosses int             `json:"max_consecutive_losses"`
+	Timezone             string          `json:"timezone"`
+	Reports              []*backupReport `json:"report_schedules"`
+}
+
+type backupReport struct {
+	Period ReportPeriod `json:"period"`
+	Hour   int          `json:"hour"`
+}
+
+type backupAccount struct {
+	ID              int64             `json:"id"`
+	Name            string            `json:"name"`
+	StartingBalance decimal.Decimal   `json:"starting_balance"`
+	CreatedAt       time.Time         `json:"created_at"`
+	CashFlows       []*backupCashFlow `json:"cash_flows,omitempty"`
+}
+
+type backupCashFlow struct {
+	Amount decimal.Decimal `json:"amount"`
+	Date   time.Time       `json:"date"`
+}
+
+type backupStrategy struct {
+	ID          int64         `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Rules       []*backupRule `json:"rules,omitempty"`
+}
+
+type backupRule struct {
+	ID   int64  `json:"id"`
+	Text string `json:"text"`
+}
+
+type backupDeal struct {
+	ID            int64           `json:"id"`
+	Pair          string          `json:"pair"`
+	AccountID     int64           `json:"account_id,omitempty"`
+	Open          bool            `json:"open"`
+	Amount        decimal.Decimal `json:"amount"`
+	BuyPrice      decimal.Decimal `json:"buy_price"`
+	SellPrice     decimal.Decimal `json:"sell_price"`
+	Profit        decimal.Decimal `json:"profit"`
+	ProfitPercent decimal.Decimal `json:"profit_percent"`
+	// Date - дата выхода, у открытой позиции - дата входа
+	Date       time.Time       `json:"date"`
+	EntryDate  *time.Time      `json:"entry_date,omitempty"`
+	StopLoss   decimal.Decimal `json:"stop_loss"`
+	TakeProfit decimal.Decimal `json:"take_profit"`
+
+	Note            string   `json:"note,omitempty"`
+	StrategyID      int64    `json:"strategy_id,omitempty"`
+	ExecutionRating int      `json:"execution_rating,omitempty"`
+	Emotion         string   `json:"emotion,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	// ID правила стратегии -> соблюдено ли
+	RuleChecks  map[int64]bool      `json:"rule_checks,omitempty"`
+	Attachments []*backupAttachment `json:"attachments,omitempty"`
+}
+
+type backupAttachment struct {
+	FileID string         `json:"file_id"`
+	Kind   AttachmentKind `json:"kind"`
+}
+
+type backupBreach struct {
+	Kind   LimitKind `json:"kind"`
+	DealID int64     `json:"deal_id,omitempty"`
+	Date   time.Time `json:"date"`
+}
+
+type backupAlert struct {
+	Pair      string          `json:"pair"`
+	Direction AlertDirection  `json:"direction"`
+	Level     decimal.Decimal `json:"level"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// restoreResult - итоги восстановления для сообщения пользователю
+type restoreResult struct {
+	DealsAdded   int
+	DealsUpdated int
+	DealsSkipped int
+	Accounts     int
+	Strategies   int
+	// Вложения из другого бота, их file_id здесь недействительны
+	DroppedAttachments int
+	SettingsRestored   bool
+}
+
+func backupDealFrom(deal *Deal, checks map[int64]bool, attachments []*Attachment) *backupDeal {
+	d := &backupDeal{
+		ID:              deal.ID,
+		Pair:            deal.Pair,
+		AccountID:       deal.AccountID,
+		Open:            deal.Open,
+		Amount:          deal.Amount,
+		BuyPrice:        deal.BuyPrice,
+		SellPrice:       deal.SellPrice,
+		Profit:          deal.Profit,
+		ProfitPercent:   deal.ProfitPercent,
+		Date:            deal.Date.UTC(),
+		StopLoss:        deal.StopLoss,
+		TakeProfit:      deal.TakeProfit,
+		Note:            deal.Note,
+		StrategyID:      deal.StrategyID,
+		ExecutionRating: deal.ExecutionRating,
+		Emotion:         deal.Emotion,
+		Tags:            deal.Tags,
+		RuleChecks:      checks,
+	}
+	if !deal.EntryDate.IsZero() {
+		entry := deal.EntryDate.UTC()
+		d.EntryDate = &entry
+	}
+	for _, a := range attachments {
+		d.Attachments = append(d.Attachments, &backupAttachment{FileID: a.FileID, Kind: a.Kind})
+	}
+
+	return d
+}
+
+// loadBackup собирает весь журнал пользователя в архив
+func loadBackup(chatID int64, botID int64) (*backupArchive, error) {
+	user, err := Repository.getUser(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %v not found", chatID)
+	}
+
+	archive := &backupArchive{
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		BotID:     botID,
+		Settings: backupSettings{
+			Name:                 user.Name,
+			ChatID:               user.ChatID,
+			HistoryPageSize:      user.HistoryPageSize,
+			Balance:              user.Balance,
+			CurrentAccountID:     user.CurrentAccountID,
+			MaxDailyLoss:         user.Limits.MaxDailyLoss,
+			MaxDailyTrades:       user.Limits.MaxDailyTrades,
+			MaxConsecutiveLosses: user.Limits.MaxConsecutiveLosses,
+			Timezone:             user.Timezone,
+		},
+	}
+
+	schedules, err := Repository.getReportSchedules(chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range schedules {
+		archive.Settings.Reports = append(archive.Settings.Reports, &backupReport{Period: s.Period, Hour: s.Hour})
+	}
+
+	if archive.Pairs, err = Repository.getPairs(chatID); err != nil {
+		return nil, err
+	}
+
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := Repository.getCashFlows(chatID)
+	if err != nil {
+		return nil, err
+	}
+	byAccount := make(map[int64]*backupAccount)
+	for _, a := range accounts {
+		account := &backupAccount{ID: a.ID, Name: a.Name, StartingBalance: a.StartingBalance, CreatedAt: a.CreatedAt.UTC()}
+		byAccount[a.ID] = account
+		archive.Accounts = append(archive.Accounts, account)
+	}
+	for _, f := range flows {
+		if account := byAccount[f.AccountID]; account != nil {
+			account.CashFlows = append(account.CashFlows, &backupCashFlow{Amount: f.Amount, Date: f.Date.UTC()})
+		}
+	}
+
+	strategies, err := Repository.getStrategies(chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strategies {
+		rules, err := Repository.getStrategyRules(s.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		strategy := &backupStrategy{ID: s.ID, Name: s.Name, Description: s.Description}
+		for _, rule := range rules {
+			strategy.Rules = append(strategy.Rules, &backupRule{ID: rule.ID, Text: rule.Text})
+		}
+		archive.Strategies = append(archive.Strategies, strategy)
+	}
+
+	tags, err := Repository.getTags(chatID, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		archive.Tags = append(archive.Tags, tag.Name)
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := Repository.getOpenPositions(chatID)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := Repository.getDealRuleChecks(chatID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := Repository.getAllAttachments(chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, deal := range append(deals, positions...) {
+		archive.Deals = append(archive.Deals, backupDealFrom(deal, checks[deal.ID], attachments[deal.ID]))
+	}
+
+	breaches, err := Repository.getLimitBreachList(chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, breach := range breaches {
+		archive.Breaches = append(archive.Breaches, &backupBreach{Kind: breach.Kind, DealID: breach.DealID, Date: breach.Date.UTC()})
+	}
+
+	alerts, err := Repository.getPriceAlerts(chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range alerts {
+		archive.Alerts = append(archive.Alerts, &backupAlert{Pair: alert.Pair, Direction: alert.Direction, Level: alert.Level, CreatedAt: alert.CreatedAt.UTC()})
+	}
+
+	return archive, nil
+}
+
+// validate проверяет архив перед восстановлением. Ошибки показываются пользователю
+func (a *backupArchive) validate() error {
+	if a.Version == 0 {
+		return errors.New("это не резервная копия журнала")
+	}
+	if a.Version > backupVersion {
+		return fmt.Errorf("архив версии %d создан более новой версией бота, поддерживается версия до %d", a.Version, backupVersion)
+	}
+
+	if a.Settings.HistoryPageSize < 0 {
+		return errors.New("неверный размер страницы истории")
+	}
+	if a.Settings.Timezone != "" {
+		if _, err := time.LoadLocation(a.Settings.Timezone); err != nil {
+			return fmt.Errorf("неизвестный часовой пояс %q", a.Settings.Timezone)
+		}
+	}
+	for _, report := range a.Settings.Reports {
+		if _, ok := reportNames[report.Period]; !ok || report.Hour < 0 || report.Hour > 23 {
+			return fmt.Errorf("неверное расписание отчета %q в %d часов", report.Period, report.Hour)
+		}
+	}
+
+	accounts := make(map[int64]bool)
+	for _, account := range a.Accounts {
+		if strings.TrimSpace(account.Name) == "" || accounts[account.ID] {
+			return errors.New("в архиве поврежден список счетов")
+		}
+		accounts[account.ID] = true
+	}
+	if a.Settings.CurrentAccountID != 0 && !accounts[a.Settings.CurrentAccountID] {
+		return errors.New("текущий портфель не найден среди счетов архива")
+	}
+
+	strategies := make(map[int64]bool)
+	for _, strategy := range a.Strategies {
+		if strings.TrimSpace(strategy.Name) == "" || strategies[strategy.ID] {
+			return errors.New("в архиве поврежден список стратегий")
+		}
+		strategies[strategy.ID] = true
+	}
+
+	deals := make(map[int64]bool)
+	for _, deal := range a.Deals {
+		switch {
+		case deals[deal.ID]:
+			return fmt.Errorf("сделка %d встречается в архиве дважды", deal.ID)
+		case strings.TrimSpace(deal.Pair) == "":
+			return fmt.Errorf("у сделки %d не указана пара", deal.ID)
+		case deal.Date.IsZero():
+			return fmt.Errorf("у сделки %d не указана дата", deal.ID)
+		case deal.AccountID != 0 && !accounts[deal.AccountID]:
+			return fmt.Errorf("счет сделки %d не найден в архиве", deal.ID)
+		case deal.StrategyID != 0 && !strategies[deal.StrategyID]:
+			return fmt.Errorf("сетап сделки %d не найден в архиве", deal.ID)
+		case deal.ExecutionRating < 0 || deal.ExecutionRating > 5:
+			return fmt.Errorf("неверная оценка исполнения у сделки %d", deal.ID)
+		}
+		deals[deal.ID] = true
+	}
+
+	for _, alert := range a.Alerts {
+		if alert.Direction != AlertAbove && alert.Direction != AlertBelow {
+			return fmt.Errorf("неверное направление уведомления %q", alert.Direction)
+		}
+	}
+
+	return nil
+}
+
+func (a *backupArchive) openPositions() int {
+	var n int
+	for _, deal := range a.Deals {
+		if deal.Open {
+			n++
+		}
+	}
+
+	return n
+}
+
+// currentBotID возвращает ID бота, 0 если Telegram не ответил
+func currentBotID(ctx context.Context, b *bot.Bot) int64 {
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		log.Println("Error getting bot info: ", err)
+		return 0
+	}
+
+	return me.ID
+}
+
+// sendBackup отправляет пользователю архив его журнала файлом
+func sendBackup(ctx context.Context, b *bot.Bot, chatID int64) error {
+	archive, err := loadBackup(chatID, currentBotID(ctx, b))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	loc := getUserLocation(chatID)
+	_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: "playbook_backup_" + time.Now().In(loc).Format("2006-01-02") + ".json", Data: bytes.NewReader(data)},
+		Caption: fmt.Sprintf("Резервная копия журнала: сделок %d, счетов %d, стратегий %d. Чтобы восстановить ее здесь или в другом боте, отправьте /restore и затем этот файл",
+			len(archive.Deals), len(archive.Accounts), len(archive.Strategies)),
+	})
+
+	return err
+}
+
+func backupCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	if err := sendBackup(ctx, b, chatID); err != nil {
+		log.Println("Error sending backup: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Не удалось собрать резервную копию",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+	}
+}
+
+func restoreCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Отправьте файл резервной копии (.json), полученный командой /backup",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Отмена", CallbackData: restoreCallbackPrefix + "cancel"}},
+		}},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingBackupFile
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingBackupFile)
+}
+
+// downloadBackup скачивает присланный файл и разбирает архив
+func downloadBackup(ctx context.Context, b *bot.Bot, fileID string) (*backupArchive, error) {
+	file, err := b.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("file download responded with %s", resp.Status)
+	}
+
+	var archive backupArchive
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBackupSize)).Decode(&archive); err != nil {
+		return nil, err
+	}
+
+	return &archive, nil
+}
+
+func buildRestoreSummary(a *backupArchive, sameBot bool, loc *time.Location) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Архив от %s\nСделок: %d (открытых %d)\nСчетов: %d\nСтратегий: %d\nТегов: %d\nУведомлений о цене: %d\n",
+		formatDateTime(a.CreatedAt, loc), len(a.Deals), a.openPositions(), len(a.Accounts), len(a.Strategies), len(a.Tags), len(a.Alerts)))
+
+	if !sameBot {
+		sb.WriteString("\nАрхив сделан в другом боте: скриншоты сделок не перенесутся\n")
+	}
+
+	sb.WriteString("\nЧто делать с записями, которые уже есть в журнале?\n" +
+		"Пропустить - оставить их как есть и добавить только новые\n" +
+		"Перезаписать - заменить их и настройки данными из архива\n" +
+		"Добавить копии - сохранить записи архива рядом с имеющимися")
+
+	return sb.String()
+}
+
+func handleBackupFile(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if update.Message == nil {
+		return
+	}
+
+	doc := update.Message.Document
+	var text string
+	switch {
+	case doc == nil:
+		text = "Отправьте файл резервной копии документом или нажмите 'Отмена'"
+	case doc.FileSize > maxBackupSize:
+		text = "Файл слишком большой для резервной копии"
+	}
+	if text != "" {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   text,
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	archive, err := downloadBackup(ctx, b, doc.FileID)
+	if err == nil {
+		err = archive.validate()
+	}
+	if err != nil {
+		log.Println("Error reading backup: ", err)
+
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		text = "Не удалось скачать файл, попробуйте еще раз"
+		switch {
+		case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+			text = "Файл не похож на резервную копию журнала"
+		case archive != nil:
+			text = "Архив не подходит: " + err.Error()
+		}
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   text,
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	usersPendingRestore[chatID] = archive
+	usersStates[chatID] = StateIdle
+
+	sameBot := archive.BotID != 0 && archive.BotID == currentBotID(ctx, b)
+	kb := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{{Text: restoreModeNames[restoreSkip], CallbackData: restoreCallbackPrefix + string(restoreSkip)}},
+		{{Text: restoreModeNames[restoreOverwrite], CallbackData: restoreCallbackPrefix + string(restoreOverwrite)}},
+		{{Text: restoreModeNames[restoreDuplicate], CallbackData: restoreCallbackPrefix + string(restoreDuplicate)}},
+		{{Text: "Отмена", CallbackData: restoreCallbackPrefix + "cancel"}},
+	}}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        buildRestoreSummary(archive, sameBot, getUserLocation(chatID)),
+		ReplyMarkup: kb,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func buildRestoreResultText(res *restoreResult, mode restoreMode) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Журнал восстановлен ✅ (%s)\n\nСделок добавлено: %d\n", strings.ToLower(restoreModeNames[mode]), res.DealsAdded))
+	if res.DealsUpdated > 0 {
+		sb.WriteString(fmt.Sprintf("Сделок перезаписано: %d\n", res.DealsUpdated))
+	}
+	if res.DealsSkipped > 0 {
+		sb.WriteString(fmt.Sprintf("Сделок пропущено: %d\n", res.DealsSkipped))
+	}
+	sb.WriteString(fmt.Sprintf("Новых счетов: %d\nНовых стратегий: %d\n", res.Accounts, res.Strategies))
+
+	if res.SettingsRestored {
+		sb.WriteString("Настройки восстановлены из архива\n")
+	} else {
+		sb.WriteString("Настройки оставлены текущими\n")
+	}
+	if res.DroppedAttachments > 0 {
+		sb.WriteString(fmt.Sprintf("Скриншотов не перенесено: %d, они доступны только в исходном боте\n", res.DroppedAttachments))
+	}
+
+	return sb.String()
+}
+
+func restoreCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+	messageID := getMessageID(update)
+
+	mode := restoreMode(strings.TrimPrefix(update.CallbackQuery.Data, restoreCallbackPrefix))
+	// Неизвестная кнопка не должна выбрасывать загруженный архив
+	if mode != "cancel" && restoreModeNames[mode] == "" {
+		log.Println("unknown restore mode ", mode)
+		return
+	}
+
+	archive := usersPendingRestore[chatID]
+	delete(usersPendingRestore, chatID)
+
+	var text string
+	switch {
+	case mode == "cancel":
+		if usersStates[chatID] == StateAwaitingBackupFile {
+			usersStates[chatID] = StateIdle
+		}
+		text = "Восстановление отменено"
+	case archive == nil:
+		text = "Архив не найден, отправьте /restore и файл еще раз"
+	default:
+		keepAttachments := archive.BotID != 0 && archive.BotID == currentBotID(ctx, b)
+		res, err := Repository.restoreBackup(chatID, archive, mode, keepAttachments)
+		if err != nil {
+			log.Println("Error restoring backup: ", err)
+			text = "Не удалось восстановить архив, журнал не изменен"
+			break
+		}
+
+		// Текущий портфель мог смениться, фильтр истории соберется заново
+		delete(usersHistoryFilter, chatID)
+		text = buildRestoreResultText(res, mode)
+	}
+
+	// Сообщение с кнопками может быть уже недоступно, тогда результат приходит новым сообщением
+	if messageID == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   text,
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      text,
+	}); err != nil {
+		log.Println("error editing msg ", chatID, err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// validArchive - минимальный корректный архив, тесты портят в нем по одному полю
+func validArchive() *backupArchive {
+	date := time.Date(2024, 4, 15, 12, 0, 0, 0, time.UTC)
+
+	return &backupArchive{
+		Version: backupVersion,
+		Settings: backupSettings{
+			HistoryPageSize:  10,
+			CurrentAccountID: 1,
+			Timezone:         "Europe/Moscow",
+			Reports:          []*backupReport{{Period: ReportDaily, Hour: 9}},
+		},
+		Accounts:   []*backupAccount{{ID: 1, Name: "Binance"}},
+		Strategies: []*backupStrategy{{ID: 2, Name: "Пробой"}},
+		Deals: []*backupDeal{
+			{ID: 3, Pair: "BTC/USD", Date: date, AccountID: 1, StrategyID: 2, ExecutionRating: 5},
+			{ID: 4, Pair: "ETH/USD", Date: date, Open: true},
+		},
+		Alerts: []*backupAlert{{Pair: "BTC/USD", Direction: AlertAbove, Level: decimal.NewFromInt(70000)}},
+	}
+}
+
+func TestBackupArchiveValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(a *backupArchive)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(a *backupArchive) {}},
+		{name: "no settings and records", modify: func(a *backupArchive) { *a = backupArchive{Version: backupVersion} }},
+		{name: "not a backup", modify: func(a *backupArchive) { a.Version = 0 }, wantErr: true},
+		{name: "newer version", modify: func(a *backupArchive) { a.Version = backupVersion + 1 }, wantErr: true},
+		{name: "negative page size", modify: func(a *backupArchive) { a.Settings.HistoryPageSize = -1 }, wantErr: true},
+		{name: "unknown timezone", modify: func(a *backupArchive) { a.Settings.Timezone = "Mars/Olympus" }, wantErr: true},
+		{name: "unknown report period", modify: func(a *backupArchive) { a.Settings.Reports[0].Period = "yearly" }, wantErr: true},
+		{name: "report hour out of range", modify: func(a *backupArchive) { a.Settings.Reports[0].Hour = 24 }, wantErr: true},
+		{name: "account without name", modify: func(a *backupArchive) { a.Accounts[0].Name = " " }, wantErr: true},
+		{name: "duplicate account", modify: func(a *backupArchive) { a.Accounts = append(a.Accounts, &backupAccount{ID: 1, Name: "Копия"}) }, wantErr: true},
+		{name: "unknown current account", modify: func(a *backupArchive) { a.Settings.CurrentAccountID = 9 }, wantErr: true},
+		{name: "strategy without name", modify: func(a *backupArchive) { a.Strategies[0].Name = "" }, wantErr: true},
+		{name: "duplicate deal", modify: func(a *backupArchive) { a.Deals[1].ID = a.Deals[0].ID }, wantErr: true},
+		{name: "deal without pair", modify: func(a *backupArchive) { a.Deals[0].Pair = "" }, wantErr: true},
+		{name: "deal without date", modify: func(a *backupArchive) { a.Deals[0].Date = time.Time{} }, wantErr: true},
+		{name: "deal with unknown account", modify: func(a *backupArchive) { a.Deals[0].AccountID = 9 }, wantErr: true},
+		{name: "deal with unknown strategy", modify: func(a *backupArchive) { a.Deals[0].StrategyID = 9 }, wantErr: true},
+		{name: "execution rating out of range", modify: func(a *backupArchive) { a.Deals[0].ExecutionRating = 6 }, wantErr: true},
+		{name: "unknown alert direction", modify: func(a *backupArchive) { a.Alerts[0].Direction = "sideways" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := validArchive()
+			tt.modify(archive)
+
+			err := archive.validate()
+			if tt.wantErr && err == nil {
+				t.Fatal("validate() want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("validate() error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBackupDealRoundTrip(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+
+	tests := []struct {
+		name        string
+		deal        *Deal
+		checks      map[int64]bool
+		attachments []*Attachment
+	}{
+		{
+			name: "closed deal with journal",
+			deal: &Deal{
+				ID: 1, Pair: "BTC/USD", AccountID: 2, Amount: decimal.RequireFromString("0.5"),
+				BuyPrice: decimal.NewFromInt(60000), SellPrice: decimal.RequireFromString("61000.25"),
+				Profit: decimal.RequireFromString("500.125"), ProfitPercent: decimal.RequireFromString("1.67"),
+				Date: time.Date(2024, 4, 15, 15, 30, 0, 0, msk), EntryDate: time.Date(2024, 4, 15, 10, 0, 0, 0, msk),
+				StopLoss: decimal.NewFromInt(59000), TakeProfit: decimal.NewFromInt(62000),
+				Note: "вход по плану", StrategyID: 3, ExecutionRating: 4, Emotion: "спокойствие", Tags: []string{"scalp", "btc"},
+			},
+			checks:      map[int64]bool{5: true, 6: false},
+			attachments: []*Attachment{{FileID: "photo-1", Kind: AttachmentPhoto}, {FileID: "doc-1", Kind: AttachmentDocument}},
+		},
+		{
+			name: "open position without entry date",
+			deal: &Deal{ID: 7, Pair: "ETH/USD", Open: true, Amount: decimal.NewFromInt(2), BuyPrice: decimal.NewFromInt(3000),
+				Date: time.Date(2024, 4, 15, 9, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := backupDealFrom(tt.deal, tt.checks, tt.attachments)
+
+			data, err := json.Marshal(want)
+			if err != nil {
+				t.Fatalf("Marshal() error: %v", err)
+			}
+			var got backupDeal
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+
+			if got.ID != tt.deal.ID || got.Pair != tt.deal.Pair || got.AccountID != tt.deal.AccountID || got.Open != tt.deal.Open {
+				t.Errorf("deal = %+v, want %+v", got, want)
+			}
+			for name, pair := range map[string][2]decimal.Decimal{
+				"amount":         {got.Amount, tt.deal.Amount},
+				"buy price":      {got.BuyPrice, tt.deal.BuyPrice},
+				"sell price":     {got.SellPrice, tt.deal.SellPrice},
+				"profit":         {got.Profit, tt.deal.Profit},
+				"profit percent": {got.ProfitPercent, tt.deal.ProfitPercent},
+				"stop loss":      {got.StopLoss, tt.deal.StopLoss},
+				"take profit":    {got.TakeProfit, tt.deal.TakeProfit},
+			} {
+				if !pair[0].Equal(pair[1]) {
+					t.Errorf("%s = %v, want %v", name, pair[0], pair[1])
+				}
+			}
+
+			if !got.Date.Equal(tt.deal.Date) || got.Date.Location() != time.UTC {
+				t.Errorf("date = %v, want %v in UTC", got.Date, tt.deal.Date)
+			}
+			switch {
+			case tt.deal.EntryDate.IsZero() && got.EntryDate != nil:
+				t.Errorf("entry date = %v, want none", *got.EntryDate)
+			case !tt.deal.EntryDate.IsZero() && (got.EntryDate == nil || !got.EntryDate.Equal(tt.deal.EntryDate)):
+				t.Errorf("entry date = %v, want %v", got.EntryDate, tt.deal.EntryDate)
+			}
+
+			if got.Note != tt.deal.Note || got.StrategyID != tt.deal.StrategyID || got.ExecutionRating != tt.deal.ExecutionRating ||
+				got.Emotion != tt.deal.Emotion || !slices.Equal(got.Tags, tt.deal.Tags) {
+				t.Errorf("journal = %+v, want %+v", got, want)
+			}
+			if !maps.Equal(got.RuleChecks, tt.checks) {
+				t.Errorf("rule checks = %v, want %v", got.RuleChecks, tt.checks)
+			}
+
+			if len(got.Attachments) != len(tt.attachments) {
+				t.Fatalf("attachments = %d, want %d", len(got.Attachments), len(tt.attachments))
+			}
+			for i, a := range tt.attachments {
+				if got.Attachments[i].FileID != a.FileID || got.Attachments[i].Kind != a.Kind {
+					t.Errorf("attachment %d = %+v, want %+v", i, got.Attachments[i], a)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных календаря P&L
+const calendarCallbackPrefix = "/cal:"
+
+// Форматы месяца и дня в callback-данных календаря
+const (
+	calendarMonthLayout = "2006-01"
+	calendarDayLayout   = "2006-01-02"
+)
+
+var calendarMonths = []string{"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь", "Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"}
+
+// loadCalendarDeals возвращает закрытые сделки текущего портфеля пользователя
+func loadCalendarDeals(chatID int64) ([]*Deal, *Account, error) {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	closed := make([]*Deal, 0, len(deals))
+	for _, deal := range deals {
+		if !deal.Open {
+			closed = append(closed, deal)
+		}
+	}
+
+	return closed, account, nil
+}
+
+// buildDailyStats группирует сделки месяца по дню закрытия в часовом поясе loc
+func buildDailyStats(deals []*Deal, month time.Time, loc *time.Location) map[int]*dealGroupStats {
+	days := make(map[int]*dealGroupStats)
+	for _, deal := range deals {
+		date := deal.Date.In(loc)
+		if date.Year() != month.Year() || date.Month() != month.Month() {
+			continue
+		}
+
+		if days[date.Day()] == nil {
+			days[date.Day()] = &dealGroupStats{}
+		}
+		days[date.Day()].add(deal)
+	}
+
+	return days
+}
+
+// formatCompactPnL сокращает P&L для кнопки календаря: +120, -1.5k
+func formatCompactPnL(pnl decimal.Decimal) string {
+	sign := "+"
+	if pnl.IsNegative() {
+		sign = "-"
+	}
+
+	abs := pnl.Abs()
+	if abs.GreaterThanOrEqual(decimal.NewFromInt(1000)) {
+		return sign + abs.Div(decimal.NewFromInt(1000)).Truncate(1).String() + "k"
+	}
+
+	return sign + abs.Round(0).String()
+}
+
+func buildCalendarText(days map[int]*dealGroupStats, month time.Time, account *Account) string {
+	var total dealGroupStats
+	for _, stats := range days {
+		total.merge(*stats)
+	}
+
+	text := "<b>Календарь P&amp;L 📅</b> (" + html.EscapeString(accountLabel(account)) + ")\n" +
+		calendarMonths[month.Month()-1] + " " + fmt.Sprint(month.Year()) + "\n\n"
+	if total.Count == 0 {
+		return text + "В этом месяце закрытых сделок не было"
+	}
+
+	return text + "<b>Итого:</b> " + total.String() + "\nНажмите на день, чтобы посмотреть сделки"
+}
+
+// buildCalendarKeyboard рисует месяц сеткой 7 дней в неделю, начиная с понедельника
+func buildCalendarKeyboard(days map[int]*dealGroupStats, month time.Time) *models.InlineKeyboardMarkup {
+	nop := calendarCallbackPrefix + "nop"
+
+	header := make([]models.InlineKeyboardButton, 0, len(heatmapWeekdaysRu))
+	for _, day := range heatmapWeekdaysRu {
+		header = append(header, models.InlineKeyboardButton{Text: day, CallbackData: nop})
+	}
+	keyboard := [][]models.InlineKeyboardButton{header}
+
+	var week []models.InlineKeyboardButton
+	for i := 0; i < weekdayIndex(month.Weekday()); i++ {
+		week = append(week, models.InlineKeyboardButton{Text: " ", CallbackData: nop})
+	}
+
+	for date := month; date.Month() == month.Month(); date = date.AddDate(0, 0, 1) {
+		button := models.InlineKeyboardButton{Text: fmt.Sprint(date.Day()), CallbackData: nop}
+		if stats := days[date.Day()]; stats != nil {
+			marker := "🟢"
+			if stats.PnL.IsNegative() {
+				marker = "🔴"
+			}
+			button.Text += marker + formatCompactPnL(stats.PnL)
+			button.CallbackData = calendarCallbackPrefix + "day:" + date.Format(calendarDayLayout)
+		}
+
+		week = append(week, button)
+		if len(week) == 7 {
+			keyboard = append(keyboard, week)
+			week = nil
+		}
+	}
+
+	if len(week) > 0 {
+		for len(week) < 7 {
+			week = append(week, models.InlineKeyboardButton{Text: " ", CallbackData: nop})
+		}
+		keyboard = append(keyboard, week)
+	}
+
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: "«", CallbackData: calendarCallbackPrefix + "month:" + month.AddDate(0, -1, 0).Format(calendarMonthLayout)},
+		{Text: calendarMonths[month.Month()-1], CallbackData: nop},
+		{Text: "»", CallbackData: calendarCallbackPrefix + "month:" + month.AddDate(0, 1, 0).Format(calendarMonthLayout)},
+	})
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// showCalendar отправляет календарь месяца новым сообщением или,
+// если передан messageID, редактирует уже показанное сообщение.
+func showCalendar(ctx context.Context, b *bot.Bot, chatID int64, messageID int, month time.Time) error {
+	deals, account, err := loadCalendarDeals(chatID)
+	if err != nil {
+		return err
+	}
+
+	days := buildDailyStats(deals, month, month.Location())
+	text := buildCalendarText(days, month, account)
+	keyboard := buildCalendarKeyboard(days, month)
+
+	if messageID == 0 {
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        text,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: keyboard,
+		})
+		return err
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: keyboard,
+	})
+	return err
+}
+
+// showCalendarDay показывает сделки, закрытые в выбранный день, в формате истории
+func showCalendarDay(ctx context.Context, b *bot.Bot, chatID int64, messageID int, day time.Time) error {
+	deals, _, err := loadCalendarDeals(chatID)
+	if err != nil {
+		return err
+	}
+
+	loc := day.Location()
+	data := []string{telegramFormatString("Сделки за " + formatDate(day, loc))}
+	n := 0
+	for _, deal := range deals {
+		date := deal.Date.In(loc)
+		if date.Before(day) || !date.Before(day.AddDate(0, 0, 1)) {
+			continue
+		}
+
+		n++
+		data = append(data, telegramFormatString(formatHistoryDeal(n, deal, loc)))
+	}
+	if n == 0 {
+		data = append(data, telegramFormatString("Сделок не найдено."))
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      strings.Join(data, "\n\n"),
+		ParseMode: models.ParseModeMarkdown,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: "« К календарю", CallbackData: calendarCallbackPrefix + "month:" + day.Format(calendarMonthLayout)},
+		}}},
+	})
+	return err
+}
+
+func calendarCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	now := time.Now().In(getUserLocation(chatID))
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	if err := showCalendar(ctx, b, chatID, 0, month); err != nil {
+		log.Printf("can't send calendar to %v, error: %v", chatID, err)
+	}
+}
+
+func calendarCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 || update.CallbackQuery.Message.Message == nil {
+		return
+	}
+	messageID := update.CallbackQuery.Message.Message.ID
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, calendarCallbackPrefix), ":")
+	loc := getUserLocation(chatID)
+
+	switch action {
+	case "month":
+		month, err := time.ParseInLocation(calendarMonthLayout, args, loc)
+		if err != nil {
+			log.Println("invalid calendar month ", args)
+			return
+		}
+
+		if err := showCalendar(ctx, b, chatID, messageID, month); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	case "day":
+		day, err := time.ParseInLocation(calendarDayLayout, args, loc)
+		if err != nil {
+			log.Println("invalid calendar day ", args)
+			return
+		}
+
+		if err := showCalendarDay(ctx, b, chatID, messageID, day); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	}
+}
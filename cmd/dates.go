@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных выбора даты входа и выхода
+const dateCallbackPrefix = "/date:"
+
+// Форматы даты, которые понимает parseDealDate. Точки и слеши заменяются на дефисы
+var dealDateLayouts = []string{
+	"02-01-2006 15:04",
+	"02-01-2006",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02-01 15:04",
+	"02-01",
+}
+
+// parseDealDate разбирает дату сделки в часовом поясе loc: "сегодня", "вчера 14:30",
+// "12-04-2024 09:15", "12.04", "14:30". Без времени берется текущее время суток,
+// без года - текущий год, а если дата в нем еще не наступила - прошлый.
+func parseDealDate(text string, loc *time.Location, now time.Time) (time.Time, error) {
+	now = now.In(loc)
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	text = strings.NewReplacer(".", "-", "/", "-").Replace(text)
+
+	day := now
+	switch {
+	case strings.HasPrefix(text, "сегодня"):
+		text = strings.TrimSpace(strings.TrimPrefix(text, "сегодня"))
+	case strings.HasPrefix(text, "вчера"):
+		day = now.AddDate(0, 0, -1)
+		text = strings.TrimSpace(strings.TrimPrefix(text, "вчера"))
+	default:
+		for _, layout := range dealDateLayouts {
+			parsed, err := time.ParseInLocation(layout, text, loc)
+			if err != nil {
+				continue
+			}
+
+			year := parsed.Year()
+			if !strings.Contains(layout, "2006") {
+				year = now.Year()
+			}
+			hour, minute := parsed.Hour(), parsed.Minute()
+			if !strings.Contains(layout, "15:04") {
+				hour, minute = now.Hour(), now.Minute()
+			}
+
+			date := time.Date(year, parsed.Month(), parsed.Day(), hour, minute, 0, 0, loc)
+			// "31-12", введенное 1 января, - это прошедший декабрь
+			if !strings.Contains(layout, "2006") && date.After(now) {
+				date = date.AddDate(-1, 0, 0)
+			}
+
+			return date, nil
+		}
+	}
+
+	if text == "" {
+		return day, nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", text, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("не понял дату, примеры: вчера 14:30, 12-04-2024 09:15, 14:30")
+	}
+
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc), nil
+}
+
+// holdingTime возвращает время удержания позиции, если известны вход и выход
+func (d *Deal) holdingTime() (time.Duration, bool) {
+	if d.EntryDate.IsZero() || d.Open || d.Date.Before(d.EntryDate) {
+		return 0, false
+	}
+
+	return d.Date.Sub(d.EntryDate), true
+}
+
+func askDealDate(ctx context.Context, b *bot.Bot, chatID int64, kind string) {
+	text := "Когда вошли в сделку?"
+	state := StateAwaitingEntryDate
+	if kind == "exit" {
+		text = "Когда вышли из сделки?"
+		state = StateAwaitingExitDate
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{{
+		{Text: "Сегодня", CallbackData: dateCallbackPrefix + kind + ":today"},
+		{Text: "Вчера", CallbackData: dateCallbackPrefix + kind + ":yesterday"},
+	}}
+	// Вход можно не указывать, тогда сделка не попадет в отчет по удержанию
+	if kind == "entry" {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Пропустить", CallbackData: dateCallbackPrefix + kind + ":skip"}})
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text + " Нажмите кнопку или введите дату и время, например: вчера 14:30 или 12-04-2024 09:15",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = state
+	log.Printf("update user %v state for %v  ", chatID, state)
+}
+
+func askEntryDate(ctx context.Context, b *bot.Bot, chatID int64) {
+	askDealDate(ctx, b, chatID, "entry")
+}
+
+func askExitDate(ctx context.Context, b *bot.Bot, chatID int64) {
+	askDealDate(ctx, b, chatID, "exit")
+}
+
+// setDealDate проверяет дату и записывает ее во вход или выход сделки
+func setDealDate(deal *Deal, kind string, date time.Time) error {
+	// Небольшой запас на расхождение часов
+	if date.After(time.Now().Add(time.Minute)) {
+		return fmt.Errorf("дата не может быть в будущем")
+	}
+
+	date = date.UTC()
+	if kind == "entry" {
+		deal.EntryDate = date
+		deal.entryApproximate = false
+		return nil
+	}
+
+	// Вход, выбранный кнопкой, известен только до дня: удержание по нему было бы выдуманным
+	if deal.entryApproximate {
+		deal.EntryDate = time.Time{}
+		deal.entryApproximate = false
+	}
+
+	if !deal.EntryDate.IsZero() && date.Before(deal.EntryDate) {
+		return fmt.Errorf("выход не может быть раньше входа")
+	}
+	deal.Date = date
+
+	return nil
+}
+
+// continueAfterDealDate продолжает добавление сделки после выбора даты
+func continueAfterDealDate(ctx context.Context, b *bot.Bot, update *models.Update, kind string) {
+	chatID := getChatID(update)
+	deal := usersPendingDeal[chatID]
+
+	if kind == "exit" {
+		finishDeal(ctx, b, update)
+		return
+	}
+
+	// Стоп уже посчитал калькулятор /size
+	if !deal.StopLoss.IsZero() {
+		askTakeProfit(ctx, b, chatID)
+		return
+	}
+	askStopLoss(ctx, b, chatID)
+}
+
+func handleDealDate(ctx context.Context, b *bot.Bot, update *models.Update, kind string) {
+	chatID := getChatID(update)
+	deal := usersPendingDeal[chatID]
+	if chatID == 0 || update.Message == nil || deal == nil {
+		return
+	}
+
+	date, err := parseDealDate(update.Message.Text, getUserLocation(chatID), time.Now())
+	if err == nil {
+		err = setDealDate(deal, kind, date)
+	}
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	continueAfterDealDate(ctx, b, update, kind)
+}
+
+func handleEntryDate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	handleDealDate(ctx, b, update, "entry")
+}
+
+func handleExitDate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	handleDealDate(ctx, b, update, "exit")
+}
+
+func dateCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	deal := usersPendingDeal[chatID]
+	if chatID == 0 || deal == nil {
+		return
+	}
+
+	kind, day, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, dateCallbackPrefix), ":")
+
+	// Кнопка от старого сообщения не должна менять текущий шаг
+	expected := StateAwaitingEntryDate
+	if kind == "exit" {
+		expected = StateAwaitingExitDate
+	}
+	if usersStates[chatID] != expected {
+		return
+	}
+
+	if kind == "entry" && day == "skip" {
+		deal.EntryDate = time.Time{}
+		deal.entryApproximate = false
+		continueAfterDealDate(ctx, b, update, kind)
+		return
+	}
+
+	// "Сегодня" на шаге выхода - момент закрытия. Вход, выбранный кнопкой, известен только до дня
+	date := time.Now()
+	if day == "yesterday" {
+		date = date.AddDate(0, 0, -1)
+	}
+
+	if err := setDealDate(deal, kind, date); err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	if kind == "entry" {
+		deal.entryApproximate = true
+	}
+
+	continueAfterDealDate(ctx, b, update, kind)
+}
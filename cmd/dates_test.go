@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDealDate(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	now := time.Date(2024, 4, 15, 10, 30, 0, 0, loc)
+	newYear := time.Date(2024, 1, 1, 9, 0, 0, 0, loc)
+
+	tests := []struct {
+		name    string
+		text    string
+		now     time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "today", text: "сегодня", now: now, want: now},
+		{name: "today with time", text: "Сегодня 14:05", now: now, want: time.Date(2024, 4, 15, 14, 5, 0, 0, loc)},
+		{name: "yesterday", text: "вчера", now: now, want: time.Date(2024, 4, 14, 10, 30, 0, 0, loc)},
+		{name: "yesterday with time", text: "вчера  09:15", now: now, want: time.Date(2024, 4, 14, 9, 15, 0, 0, loc)},
+		{name: "time only", text: "08:00", now: now, want: time.Date(2024, 4, 15, 8, 0, 0, 0, loc)},
+		{name: "full date and time", text: "12-04-2023 09:15", now: now, want: time.Date(2023, 4, 12, 9, 15, 0, 0, loc)},
+		{name: "full date with dots", text: "12.04.2023", now: now, want: time.Date(2023, 4, 12, 10, 30, 0, 0, loc)},
+		{name: "iso date and time", text: "2023-04-12 09:15", now: now, want: time.Date(2023, 4, 12, 9, 15, 0, 0, loc)},
+		{name: "iso date with slashes", text: "2023/04/12", now: now, want: time.Date(2023, 4, 12, 10, 30, 0, 0, loc)},
+		{name: "no year with time", text: "12-04 09:15", now: now, want: time.Date(2024, 4, 12, 9, 15, 0, 0, loc)},
+		{name: "no year and time", text: "12.04", now: now, want: time.Date(2024, 4, 12, 10, 30, 0, 0, loc)},
+		{name: "no year in the future", text: "31-12", now: newYear, want: time.Date(2023, 12, 31, 9, 0, 0, 0, loc)},
+		{name: "utc now", text: "сегодня", now: now.UTC(), want: now},
+		{name: "garbage", text: "когда-то", now: now, wantErr: true},
+		{name: "bad time", text: "вчера 25:00", now: now, wantErr: true},
+		{name: "bad date", text: "31-02-2024", now: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDealDate(tt.text, loc, tt.now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDealDate(%q) = %v, want error", tt.text, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDealDate(%q) error: %v", tt.text, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseDealDate(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDealDate(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	entry := now.Add(-3 * time.Hour)
+
+	tests := []struct {
+		name        string
+		deal        Deal
+		exit        time.Time
+		wantHolding time.Duration
+		wantOK      bool
+		wantErr     bool
+	}{
+		{name: "typed entry", deal: Deal{EntryDate: entry}, exit: now, wantHolding: 3 * time.Hour, wantOK: true},
+		{name: "skipped entry", deal: Deal{}, exit: now, wantOK: false},
+		{name: "entry from button", deal: Deal{EntryDate: entry, entryApproximate: true}, exit: now, wantOK: false},
+		{name: "exit before entry", deal: Deal{EntryDate: now}, exit: entry, wantErr: true},
+		{name: "exit in the future", deal: Deal{}, exit: now.Add(time.Hour), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deal := tt.deal
+			err := setDealDate(&deal, "exit", tt.exit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("setDealDate() want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setDealDate() error: %v", err)
+			}
+
+			holding, ok := deal.holdingTime()
+			if ok != tt.wantOK || holding != tt.wantHolding {
+				t.Errorf("holdingTime() = %v, %v, want %v, %v", holding, ok, tt.wantHolding, tt.wantOK)
+			}
+		})
+	}
+}
@@ -6,12 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	"github.com/go-telegram/ui/paginator"
 	"github.com/shopspring/decimal"
 )
 
@@ -19,6 +19,17 @@ func defaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	chatID := getChatID(update)
 	currentState := usersStates[chatID]
 
+	// Файл резервной копии не должен попасть в скриншоты сделки
+	if currentState == StateAwaitingBackupFile {
+		handleBackupFile(ctx, b, update)
+		return
+	}
+
+	if attachmentFromMessage(update.Message) != nil {
+		handleAttachment(ctx, b, update)
+		return
+	}
+
 	switch currentState {
 	case StateAwaitingSavePair:
 		handleSavePair(ctx, b, update)
@@ -28,8 +39,48 @@ func defaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 		handleAmount(ctx, b, update)
 	case StateAwaitingBuyPrice:
 		handleBuyPrice(ctx, b, update)
+	case StateAwaitingStopLoss:
+		handleStopLoss(ctx, b, update)
+	case StateAwaitingTakeProfit:
+		handleTakeProfit(ctx, b, update)
 	case StateAwaitingSellPrice:
 		handleSellPrice(ctx, b, update)
+	case StateAwaitingEntryDate:
+		handleEntryDate(ctx, b, update)
+	case StateAwaitingExitDate:
+		handleExitDate(ctx, b, update)
+	case StateAwaitingSizeBalance:
+		handleSizeBalance(ctx, b, update)
+	case StateAwaitingSizeRisk:
+		handleSizeRisk(ctx, b, update)
+	case StateAwaitingSizeEntry:
+		handleSizeEntry(ctx, b, update)
+	case StateAwaitingSizeStop:
+		handleSizeStop(ctx, b, update)
+	case StateAwaitingAccountName:
+		handleAccountName(ctx, b, update)
+	case StateAwaitingAccountBalance:
+		handleAccountBalance(ctx, b, update)
+	case StateAwaitingCashFlow:
+		handleCashFlow(ctx, b, update)
+	case StateAwaitingLimitValue:
+		handleLimitValue(ctx, b, update)
+	case StateAwaitingReportHour:
+		handleReportHour(ctx, b, update)
+	case StateAwaitingTimezone:
+		handleTimezone(ctx, b, update)
+	case StateAwaitingHistoryDate:
+		handleHistoryDate(ctx, b, update)
+	case StateAwaitingJournalNote:
+		handleJournalNote(ctx, b, update)
+	case StateAwaitingJournalStrategy:
+		handleJournalStrategy(ctx, b, update)
+	case StateAwaitingStrategyName:
+		handleStrategyName(ctx, b, update)
+	case StateAwaitingStrategyDescription:
+		handleStrategyDescription(ctx, b, update)
+	case StateAwaitingStrategyRules:
+		handleStrategyRules(ctx, b, update)
 	default:
 		err := showStandardButtons(ctx, b, update)
 		if err != nil {
@@ -158,6 +209,13 @@ func addDealCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Upda
 		return
 	}
 
+	delete(usersPendingDeal, chatID)
+	askDealPair(ctx, b, chatID)
+}
+
+// askDealPair предлагает выбрать пару для новой сделки. Если в usersPendingDeal уже лежит
+// сделка, например заполненная калькулятором /size, ее значения сохранятся.
+func askDealPair(ctx context.Context, b *bot.Bot, chatID int64) {
 	// Получаем пользователя
 	userPairs, err := Repository.getPairs(chatID)
 	if err != nil {
@@ -172,7 +230,7 @@ func addDealCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Upda
 			ChatID: chatID,
 			Text:   "У вас пока нет ни одной пары для добавления сделки. Вы можете добавить их с помощью кнопки 'Добавить пару'.",
 		}); err != nil {
-			log.Println("error sending msg ", getChatID(update), err)
+			log.Println("error sending msg ", chatID, err)
 			return
 		}
 
@@ -189,7 +247,7 @@ func addDealCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Upda
 		Text:        "Выберите пару для добавления сделки:",
 		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
 	}); err != nil {
-		log.Println("error sending msg ", getChatID(update), err)
+		log.Println("error sending msg ", chatID, err)
 		return
 	}
 
@@ -222,10 +280,32 @@ func handlePairSelection(ctx context.Context, b *bot.Bot, update *models.Update)
 		}
 	}
 
-	usersPendingDeal[chatID] = &Deal{Pair: update.CallbackQuery.Data}
+	deal := usersPendingDeal[chatID]
+	if deal == nil {
+		deal = &Deal{}
+		usersPendingDeal[chatID] = deal
+	}
+	deal.Pair = update.CallbackQuery.Data
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Пока заполняете сделку, можно отправить скриншоты графика — они сохранятся вместе с ней 📎",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+
+	askDealAccount(ctx, b, chatID)
+}
+
+func askDealAmount(ctx context.Context, b *bot.Bot, chatID int64) {
+	// Количество, цену покупки и стоп уже посчитал калькулятор /size
+	if deal := usersPendingDeal[chatID]; deal != nil && !deal.Amount.IsZero() && !deal.BuyPrice.IsZero() {
+		askEntryDate(ctx, b, chatID)
+		return
+	}
 
 	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "Укажите количесвто:"}); err != nil {
-		log.Println("error sending msg ", getChatID(update), err)
+		log.Println("error sending msg ", chatID, err)
 		return
 	}
 
@@ -252,11 +332,24 @@ func handleBuyPrice(ctx context.Context, b *bot.Bot, update *models.Update) {
 	}
 	usersPendingDeal[chatID].BuyPrice = buyPrice
 
-	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+	askEntryDate(ctx, b, chatID)
+}
+
+func askSellPrice(ctx context.Context, b *bot.Bot, chatID int64) {
+	params := &bot.SendMessageParams{
 		ChatID: chatID,
 		Text:   "Укажите цену продажи:",
-	}); err != nil {
-		log.Println("error sending msg ", getChatID(update), err)
+	}
+
+	// Новую сделку можно сохранить как открытую позицию и закрыть позже
+	if deal := usersPendingDeal[chatID]; deal != nil && deal.ID == 0 {
+		params.ReplyMarkup = models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Позиция еще открыта", CallbackData: positionCallbackPrefix + "keep_open"}},
+		}}
+	}
+
+	if _, err := b.SendMessage(ctx, params); err != nil {
+		log.Println("error sending msg ", chatID, err)
 		return
 	}
 
@@ -284,6 +377,13 @@ func handleSellPrice(ctx context.Context, b *bot.Bot, update *models.Update) {
 	}
 	usersPendingDeal[chatID].SellPrice = sellPrice
 
+	askExitDate(ctx, b, chatID)
+}
+
+// finishDeal сохраняет заполненную сделку и возвращает пользователя в главное меню
+func finishDeal(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+
 	completeDeal(ctx, b, chatID, usersPendingDeal[chatID])
 
 	if err := showStandardButtons(ctx, b, update); err != nil {
@@ -295,15 +395,30 @@ func handleSellPrice(ctx context.Context, b *bot.Bot, update *models.Update) {
 	log.Printf("update user %v state for %v  ", chatID, StateIdle)
 }
 
-func completeDeal(ctx context.Context, b *bot.Bot, chatID int64, PendingDeal *Deal) {
+// calculateProfit считает прибыль сделки по ценам покупки и продажи
+func calculateProfit(d *Deal) {
 	// Профит = (цена продажи - цена покупки) * количество
-	PendingDeal.Profit = PendingDeal.SellPrice.Sub(PendingDeal.BuyPrice).Mul(PendingDeal.Amount).Truncate(3)
+	d.Profit = d.SellPrice.Sub(d.BuyPrice).Mul(d.Amount).Truncate(3)
 	// Процент прибыли = (цена продажи - цена покупки) / цена покупки * 100
-	PendingDeal.ProfitPercent = PendingDeal.SellPrice.Sub(PendingDeal.BuyPrice).Div(PendingDeal.BuyPrice).Mul(decimal.NewFromInt(100)).Truncate(3)
+	d.ProfitPercent = d.SellPrice.Sub(d.BuyPrice).Div(d.BuyPrice).Mul(decimal.NewFromInt(100)).Truncate(3)
+}
 
-	PendingDeal.Date = time.Now()
+// completeDeal сохраняет новую сделку или закрывает открытую позицию, если у сделки уже есть ID
+func completeDeal(ctx context.Context, b *bot.Bot, chatID int64, PendingDeal *Deal) {
+	calculateProfit(PendingDeal)
+
+	if PendingDeal.Date.IsZero() {
+		PendingDeal.Date = time.Now().UTC()
+	}
 
-	err := Repository.saveDeal(PendingDeal, chatID)
+	closing := PendingDeal.ID != 0
+
+	var err error
+	if closing {
+		err = Repository.closeDeal(PendingDeal, chatID)
+	} else {
+		err = Repository.saveDeal(PendingDeal, chatID)
+	}
 	if err != nil {
 		log.Println("Error saving deal: ", err)
 		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
@@ -317,68 +432,103 @@ func completeDeal(ctx context.Context, b *bot.Bot, chatID int64, PendingDeal *De
 		return
 	}
 
-	dealText := "<b> Сделка успешно добавлена 🎉 Ваша сделка:</b>\n" +
+	title := "<b> Сделка успешно добавлена 🎉 Ваша сделка:</b>\n"
+	if closing {
+		title = "<b> Позиция закрыта 🎉 Ваша сделка:</b>\n"
+	}
+
+	dealText := title +
 		"<b>Пара:</b> " + PendingDeal.Pair + "\n" +
 		"<b>Количество:</b> " + PendingDeal.Amount.String() + "\n" +
 		"<b>Покупка:</b> " + PendingDeal.BuyPrice.String() + "\n" +
 		"<b>Продажа:</b> " + PendingDeal.SellPrice.String() + "\n" +
 		"<b>Прибыль:</b> " + PendingDeal.Profit.String() + "$\n" +
 		"<b>Процент прибыли:</b> " + PendingDeal.ProfitPercent.Truncate(3).String() + "%\n"
+	loc := getUserLocation(chatID)
+	if !PendingDeal.EntryDate.IsZero() {
+		dealText += "<b>Вход:</b> " + formatDateTime(PendingDeal.EntryDate, loc) + "\n"
+	}
+	dealText += "<b>Выход:</b> " + formatDateTime(PendingDeal.Date, loc) + "\n"
+	if holding, ok := PendingDeal.holdingTime(); ok {
+		dealText += "<b>Удержание:</b> " + formatDuration(holding) + "\n"
+	}
+	if !PendingDeal.StopLoss.IsZero() {
+		dealText += "<b>Стоп-лосс:</b> " + PendingDeal.StopLoss.String() + "\n"
+	}
+	if !PendingDeal.TakeProfit.IsZero() {
+		dealText += "<b>Тейк-профит:</b> " + PendingDeal.TakeProfit.String() + "\n"
+	}
+	if risk, ok := PendingDeal.initialRisk(); ok {
+		dealText += "<b>Риск:</b> " + risk.String() + "$\n"
+	}
+	if r, ok := PendingDeal.rMultiple(); ok {
+		dealText += "<b>Результат:</b> " + r.String() + "R\n"
+	}
+	if rr, ok := PendingDeal.plannedRewardRisk(); ok {
+		dealText += "<b>План R:R:</b> 1:" + rr.String() + "\n"
+	}
+	if len(PendingDeal.Attachments) > 0 {
+		dealText += "<b>Скриншотов:</b> " + strconv.Itoa(len(PendingDeal.Attachments)) + "\n"
+	}
 	fmt.Printf("%v deal: \nbuy price %v\nsell price %v \nprofit %v\nprofit percentage %v\n", chatID, PendingDeal.BuyPrice, PendingDeal.SellPrice, PendingDeal.Profit, PendingDeal.ProfitPercent)
 
 	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    chatID,
 		Text:      dealText,
 		ParseMode: "HTML",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Заполнить журнал 📝", CallbackData: journalCallbackPrefix + "start:" + strconv.FormatInt(PendingDeal.ID, 10)}},
+			{{Text: "Прикрепить скриншот 📎", CallbackData: mediaCallbackPrefix + "attach:" + strconv.FormatInt(PendingDeal.ID, 10)}},
+		}},
 	}); err != nil {
 		log.Printf("can't send message to %v, error: %v", chatID, err)
 	}
 
 	usersPendingDeal[chatID] = nil
+
+	enforceLimits(ctx, b, chatID, PendingDeal)
 }
 
 func getHistoryCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	opts := []paginator.Option{
-		paginator.PerPage(3),
-		paginator.WithCloseButton("Close"),
-	}
+	chatID := getChatID(update)
+	size := getUserHistoryPageSize(chatID)
 
-	userDeals, err := Repository.getDeals(getChatID(update))
+	filter := dealFilter{AccountID: currentAccountID(chatID)}
+	usersHistoryFilter[chatID] = filter
+	page, err := loadHistoryPage(chatID, filter, size, nil, 0, false)
 	if err != nil {
 		log.Println("Error getting deals: ", err)
 		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: getChatID(update),
+			ChatID: chatID,
 			Text:   "Ошибка получения истории сделок",
 		}); err != nil {
-			log.Printf("can't send message to %v, error: %v", getChatID(update), err)
+			log.Printf("can't send message to %v, error: %v", chatID, err)
 		}
 
 		return
 	}
 
-	if len(userDeals) == 0 {
+	if page.total == 0 {
 		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: getChatID(update),
+			ChatID: chatID,
 			Text:   "кажется у вас еще нет сделок :(",
 		}); err != nil {
-			log.Printf("can't send message to %v, error: %v", getChatID(update), err)
+			log.Printf("can't send message to %v, error: %v", chatID, err)
 		}
 		return
 	}
 
-	data := make([]string, 0, len(userDeals))
-	for i, deal := range userDeals {
-		data = append(data, telegramFormatString(fmt.Sprintf("%v. Пара: %s\nКоличество: %s\nПокупка: %s$\nПродажа: %s$\nПрибыль: %s$\nПроцент прибыли: %s%%\nДата: %s\n", i+1, deal.Pair, deal.Amount.String(), deal.BuyPrice.String(), deal.SellPrice.String(), deal.Profit.String(), deal.ProfitPercent.String(), deal.Date.Format("02-01-2006"))))
-	}
-
-	p := paginator.New(data, opts...)
-
-	if _, err := p.Show(ctx, b, getChatID(update)); err != nil {
-		log.Printf("can't send message to %v, error: %v", getChatID(update), err)
+	if err := showHistoryPage(ctx, b, chatID, 0, page); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
 	}
 }
 
 func showStandardButtons(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	account, err := currentAccount(getChatID(update))
+	if err != nil {
+		log.Println("Error getting current account: ", err)
+	}
+
 	kb := &models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{
 			{
@@ -387,11 +537,20 @@ func showStandardButtons(ctx context.Context, b *bot.Bot, update *models.Update)
 			},
 			{
 				{Text: "История сделок", CallbackData: "/get_history"},
+				{Text: "Статистика", CallbackData: "/stats"},
+			},
+			{
+				{Text: "Открытые позиции", CallbackData: "/positions"},
+				{Text: "Плейбук", CallbackData: "/playbook"},
+			},
+			{
+				{Text: "Портфель: " + accountLabel(account), CallbackData: accountCallbackPrefix + "switch"},
+				{Text: "Счета", CallbackData: "/accounts"},
 			},
 		},
 	}
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:      getChatID(update),
 		Text:        "Выберите действие",
 		ReplyMarkup: kb,
@@ -405,7 +564,7 @@ func showStandardButtons(ctx context.Context, b *bot.Bot, update *models.Update)
 }
 
 func startCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
-	message := "Привет 👋\nЭто Бот с помощью которого можно вести учет ваших сделок📖\n\nПоддерживаемые команды:\n/add_deal - добавить новую сделку\n/add_pair - добавить актив/пару\n/get_history - получить историю сделок"
+	message := "Привет 👋\nЭто Бот с помощью которого можно вести учет ваших сделок📖\n\nПоддерживаемые команды:\n/add_deal - добавить новую сделку\n/add_pair - добавить актив/пару\n/get_history - получить историю сделок\n/stats - статистика по стратегиям и правилам\n/tags - отчет по тегам\n/size - калькулятор размера позиции\n/positions - открытые позиции\n/portfolio - текущий P&L открытых позиций\n/accounts - счета, пополнения и выводы\n/limits - дневные лимиты торговли\n/risk_report - просадка, Шарп и Сортино\n/holding - результаты по времени удержания\n/heatmap - результаты по дням недели и часам\n/calendar - календарь P&L по дням\n/tax 2024 - налоговый отчет за год (FIFO)\n/report - PDF-отчет за месяц\n/export - выгрузка сделок в Excel\n/backup - резервная копия журнала, /restore - восстановление из копии\n/my_data - какие данные о вас хранятся, /delete_me - удалить все данные\n/alert - уведомление о цене, /alerts - список уведомлений\n/reports - автоматические отчеты по расписанию\n/timezone - ваш часовой пояс\n/playbook - ваши стратегии и правила входа"
 	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
 		Text:   message,
@@ -453,11 +612,20 @@ func showMessageWithUserName(next bot.HandlerFunc) bot.HandlerFunc {
 	}
 }
 
+// getChatID возвращает чат сообщения или нажатой кнопки. Сообщение с кнопкой может быть
+// недоступно боту (удалено или слишком старое), тогда чат берется из него или из автора нажатия
 func getChatID(update *models.Update) int64 {
 	if update.Message != nil {
 		return update.Message.Chat.ID
 	} else if update.CallbackQuery != nil {
-		return update.CallbackQuery.Message.Message.Chat.ID
+		switch message := update.CallbackQuery.Message; {
+		case message.Message != nil:
+			return message.Message.Chat.ID
+		case message.InaccessibleMessage != nil:
+			return message.InaccessibleMessage.Chat.ID
+		default:
+			return update.CallbackQuery.From.ID
+		}
 	}
 
 	return 0
@@ -467,12 +635,24 @@ func getUserName(update *models.Update) string {
 	if update.Message != nil {
 		return update.Message.Chat.Username
 	} else if update.CallbackQuery != nil {
-		return update.CallbackQuery.Message.Message.Chat.Username
+		if update.CallbackQuery.Message.Message != nil {
+			return update.CallbackQuery.Message.Message.Chat.Username
+		}
+		return update.CallbackQuery.From.Username
 	}
 
 	return ""
 }
 
+// getMessageID возвращает сообщение с нажатой кнопкой, 0 - если оно недоступно и его нельзя отредактировать
+func getMessageID(update *models.Update) int {
+	if update.CallbackQuery != nil && update.CallbackQuery.Message.Message != nil {
+		return update.CallbackQuery.Message.Message.ID
+	}
+
+	return 0
+}
+
 func validatePrice(price string) (decimal.Decimal, error) {
 	if price == "" {
 		return decimal.Decimal{}, fmt.Errorf("empty price")
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestGetChatID(t *testing.T) {
+	tests := []struct {
+		name          string
+		update        *models.Update
+		wantChat      int64
+		wantUser      string
+		wantMessageID int
+	}{
+		{
+			name:     "message",
+			update:   &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1, Username: "trader"}}},
+			wantChat: 1, wantUser: "trader",
+		},
+		{
+			name: "callback",
+			update: &models.Update{CallbackQuery: &models.CallbackQuery{
+				Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 7, Chat: models.Chat{ID: 2, Username: "trader"}}},
+			}},
+			wantChat: 2, wantUser: "trader", wantMessageID: 7,
+		},
+		{
+			name: "callback on inaccessible message",
+			update: &models.Update{CallbackQuery: &models.CallbackQuery{
+				From:    models.User{ID: 3, Username: "from"},
+				Message: models.MaybeInaccessibleMessage{InaccessibleMessage: &models.InaccessibleMessage{MessageID: 8, Chat: models.Chat{ID: 4}}},
+			}},
+			wantChat: 4, wantUser: "from",
+		},
+		{
+			name:     "callback without message",
+			update:   &models.Update{CallbackQuery: &models.CallbackQuery{From: models.User{ID: 5, Username: "from"}}},
+			wantChat: 5, wantUser: "from",
+		},
+		{name: "other update", update: &models.Update{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getChatID(tt.update); got != tt.wantChat {
+				t.Errorf("getChatID() = %d, want %d", got, tt.wantChat)
+			}
+			if got := getUserName(tt.update); got != tt.wantUser {
+				t.Errorf("getUserName() = %q, want %q", got, tt.wantUser)
+			}
+			if got := getMessageID(tt.update); got != tt.wantMessageID {
+				t.Errorf("getMessageID() = %d, want %d", got, tt.wantMessageID)
+			}
+		})
+	}
+}
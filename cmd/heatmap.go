@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Размеры тепловой карты в пикселях
+const (
+	heatmapCell   = 28
+	heatmapLeft   = 44
+	heatmapTop    = 24
+	heatmapBottom = 12
+)
+
+// Дни недели с понедельника. Встроенный шрифт картинки поддерживает только латиницу
+var (
+	heatmapWeekdays      = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+	heatmapWeekdaysRu    = []string{"Пн", "Вт", "Ср", "Чт", "Пт", "Сб", "Вс"}
+	heatmapEmptyColor    = color.RGBA{R: 235, G: 235, B: 235, A: 255}
+	heatmapGridColor     = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	heatmapTextColor     = color.RGBA{R: 60, G: 60, B: 60, A: 255}
+	heatmapProfitColor   = color.RGBA{R: 46, G: 160, B: 67, A: 255}
+	heatmapLossColor     = color.RGBA{R: 214, G: 48, B: 49, A: 255}
+	heatmapBackground    = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	heatmapMinColorShare = 0.2
+)
+
+// tradingHeatmap - результаты сделок по дням недели (с понедельника) и часам
+type tradingHeatmap [7][24]dealGroupStats
+
+// weekdayIndex переводит день недели Go (с воскресенья) в индекс с понедельника
+func weekdayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// buildTradingHeatmap раскладывает сделки по времени входа в часовом поясе пользователя.
+// Если вход не указан, берется время закрытия.
+func buildTradingHeatmap(deals []*Deal, loc *time.Location) *tradingHeatmap {
+	var heatmap tradingHeatmap
+	for _, deal := range deals {
+		at := deal.Date
+		if !deal.EntryDate.IsZero() {
+			at = deal.EntryDate
+		}
+		at = at.In(loc)
+		heatmap[weekdayIndex(at.Weekday())][at.Hour()].add(deal)
+	}
+
+	return &heatmap
+}
+
+// blend смешивает цвет пустой клетки с цветом результата в доле share
+func blend(to color.RGBA, share float64) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*share)
+	}
+
+	return color.RGBA{R: mix(heatmapEmptyColor.R, to.R), G: mix(heatmapEmptyColor.G, to.G), B: mix(heatmapEmptyColor.B, to.B), A: 255}
+}
+
+func drawLabel(img draw.Image, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(heatmapTextColor),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// renderHeatmapPNG рисует тепловую карту: зеленый - прибыль, красный - убыток,
+// насыщенность пропорциональна P&L относительно самой результативной клетки
+func renderHeatmapPNG(heatmap *tradingHeatmap) ([]byte, error) {
+	var maxAbs float64
+	for day := range heatmap {
+		for hour := range heatmap[day] {
+			pnl := heatmap[day][hour].PnL.Abs().InexactFloat64()
+			if pnl > maxAbs {
+				maxAbs = pnl
+			}
+		}
+	}
+
+	width := heatmapLeft + 24*heatmapCell + heatmapBottom
+	height := heatmapTop + 7*heatmapCell + heatmapBottom
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(heatmapBackground), image.Point{}, draw.Src)
+
+	for hour := 0; hour < 24; hour += 2 {
+		drawLabel(img, heatmapLeft+hour*heatmapCell+6, heatmapTop-8, fmt.Sprintf("%02d", hour))
+	}
+
+	for day := range heatmap {
+		y := heatmapTop + day*heatmapCell
+		drawLabel(img, 8, y+heatmapCell/2+4, heatmapWeekdays[day])
+
+		for hour := range heatmap[day] {
+			stats := heatmap[day][hour]
+			fill := heatmapEmptyColor
+			if stats.Count > 0 && maxAbs > 0 {
+				share := heatmapMinColorShare + (1-heatmapMinColorShare)*stats.PnL.Abs().InexactFloat64()/maxAbs
+				if stats.PnL.IsNegative() {
+					fill = blend(heatmapLossColor, share)
+				} else {
+					fill = blend(heatmapProfitColor, share)
+				}
+			}
+
+			x := heatmapLeft + hour*heatmapCell
+			cell := image.Rect(x, y, x+heatmapCell, y+heatmapCell)
+			draw.Draw(img, cell, image.NewUniform(heatmapGridColor), image.Point{}, draw.Src)
+			draw.Draw(img, cell.Inset(1), image.NewUniform(fill), image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// buildHeatmapText - текстовая версия карты: итоги по дням недели и часам с доходом
+func buildHeatmapText(heatmap *tradingHeatmap, title string) string {
+	var byHour [24]dealGroupStats
+	var sb strings.Builder
+	sb.WriteString(title + "\n\n<b>По дням недели:</b>\n")
+
+	for day := range heatmap {
+		var dayStats dealGroupStats
+		for hour, stats := range heatmap[day] {
+			dayStats.merge(stats)
+			byHour[hour].merge(stats)
+		}
+		if dayStats.Count > 0 {
+			sb.WriteString(heatmapWeekdaysRu[day] + ": " + dayStats.String() + "\n")
+		}
+	}
+
+	sb.WriteString("\n<b>По часам:</b>\n")
+	for hour, stats := range byHour {
+		if stats.Count > 0 {
+			sb.WriteString(fmt.Sprintf("%02d:00: %s\n", hour, stats.String()))
+		}
+	}
+
+	return sb.String()
+}
+
+func heatmapCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	account, err := currentAccount(chatID)
+	if err != nil {
+		log.Println("Error getting current account: ", err)
+		return
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		log.Println("Error getting deals: ", err)
+		return
+	}
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	if len(deals) == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "кажется у вас еще нет сделок :(",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	loc := getUserLocation(chatID)
+	heatmap := buildTradingHeatmap(deals, loc)
+	title := "<b>Когда вы торгуете лучше 🔥</b> (" + html.EscapeString(accountLabel(account)) + ", " + html.EscapeString(loc.String()) + ")"
+	text := buildHeatmapText(heatmap, title)
+
+	picture, err := renderHeatmapPNG(heatmap)
+	if err == nil {
+		_, err = b.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:    chatID,
+			Photo:     &models.InputFileUpload{Filename: "heatmap.png", Data: bytes.NewReader(picture)},
+			Caption:   title + "\nЗеленый - прибыль, красный - убыток, по времени входа",
+			ParseMode: models.ParseModeHTML,
+		})
+	}
+	if err != nil {
+		log.Printf("can't send heatmap to %v, error: %v", chatID, err)
+	}
+
+	// Таблица дополняет картинку точными цифрами и заменяет ее, если картинку отправить не удалось
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных пейджера истории сделок
+const historyCallbackPrefix = "/hist:"
+
+const defaultHistoryPageSize = 3
+
+// Размеры страницы истории, из которых может выбрать пользователь
+var historyPageSizes = []int{3, 5, 10, 20}
+
+// Мапа фильтров истории, выбранных пользователями
+var usersHistoryFilter = make(map[int64]dealFilter)
+
+type historyPage struct {
+	deals   []*Deal
+	offset  int // количество сделок в истории перед первой сделкой страницы
+	total   int
+	hasNext bool
+	filter  string // описание фильтра для заголовка страницы
+	loc     *time.Location
+}
+
+// loadHistoryPage загружает из базы одну страницу истории, начиная с позиции курсора.
+// При backward загружается страница, которая идет перед курсором.
+func loadHistoryPage(userID int64, filter dealFilter, size int, cursor *dealCursor, offset int, backward bool) (*historyPage, error) {
+	total, err := Repository.countDeals(userID, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var title string
+	if filter.TagID != 0 {
+		tag, err := Repository.getTag(userID, filter.TagID)
+		if err != nil {
+			return nil, err
+		}
+		if tag != nil {
+			title = "#" + tag.Name
+		}
+	}
+
+	if backward && cursor != nil {
+		deals, err := Repository.getNewerDeals(userID, filter, *cursor, size)
+		if err != nil {
+			return nil, err
+		}
+
+		// Дошли до начала истории, показываем первую страницу целиком
+		if len(deals) < size {
+			return loadHistoryPage(userID, filter, size, nil, 0, false)
+		}
+
+		return &historyPage{deals: deals, offset: max(offset-size, 0), total: total, hasNext: true, filter: title, loc: getUserLocation(userID)}, nil
+	}
+
+	deals, err := Repository.getOlderDeals(userID, filter, cursor, size+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &historyPage{deals: deals, offset: offset, total: total, filter: title, loc: getUserLocation(userID)}
+	if len(deals) > size {
+		page.deals = deals[:size]
+		page.hasNext = true
+	}
+
+	return page, nil
+}
+
+func getUserHistoryPageSize(chatID int64) int {
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil || user.HistoryPageSize <= 0 {
+		return defaultHistoryPageSize
+	}
+
+	return user.HistoryPageSize
+}
+
+func formatHistoryDeal(n int, deal *Deal, loc *time.Location) string {
+	if deal.Open {
+		return fmt.Sprintf("%v. Пара: %s\nКоличество: %s\nПокупка: %s$\nСтатус: открыта\nДата: %s\n", n, deal.Pair, deal.Amount.String(), deal.BuyPrice.String(), formatDateTime(deal.Date, loc)) + formatRisk(deal) + formatJournal(deal)
+	}
+
+	return fmt.Sprintf("%v. Пара: %s\nКоличество: %s\nПокупка: %s$\nПродажа: %s$\nПрибыль: %s$\nПроцент прибыли: %s%%\nДата: %s\n", n, deal.Pair, deal.Amount.String(), deal.BuyPrice.String(), deal.SellPrice.String(), deal.Profit.String(), deal.ProfitPercent.String(), formatDateTime(deal.Date, loc)) + formatHolding(deal, loc) + formatRisk(deal) + formatJournal(deal)
+}
+
+// formatHolding выводит дату входа и время удержания, если вход указан
+func formatHolding(deal *Deal, loc *time.Location) string {
+	holding, ok := deal.holdingTime()
+	if !ok {
+		return ""
+	}
+
+	return "Вход: " + formatDateTime(deal.EntryDate, loc) + "\nУдержание: " + formatDuration(holding) + "\n"
+}
+
+func encodeHistoryCursor(action string, offset int, deal *Deal) string {
+	return fmt.Sprintf("%s%s:%d:%d:%d", historyCallbackPrefix, action, offset, deal.Date.UnixMicro(), deal.ID)
+}
+
+func decodeHistoryCursor(args string) (int, *dealCursor, error) {
+	parts := strings.Split(args, ":")
+	if len(parts) != 3 {
+		return 0, nil, fmt.Errorf("invalid history cursor %q", args)
+	}
+
+	offset, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	micros, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return offset, &dealCursor{Date: time.UnixMicro(micros).UTC(), ID: id}, nil
+}
+
+func buildHistoryText(page *historyPage) string {
+	var header string
+	if page.filter != "" {
+		header = telegramFormatString(fmt.Sprintf("Фильтр: %s (сделок: %d)", page.filter, page.total)) + "\n\n"
+	}
+
+	if len(page.deals) == 0 {
+		return header + telegramFormatString("Сделок не найдено.")
+	}
+
+	data := make([]string, 0, len(page.deals))
+	for i, deal := range page.deals {
+		data = append(data, telegramFormatString(formatHistoryDeal(page.offset+i+1, deal, page.loc)))
+	}
+
+	return header + strings.Join(data, "\n\n")
+}
+
+func buildHistoryKeyboard(page *historyPage) *models.InlineKeyboardMarkup {
+	// После перехода к дате смещение не кратно размеру страницы, поэтому показываем номера сделок, а не страницы
+	position := "0 из 0"
+	if len(page.deals) > 0 {
+		position = fmt.Sprintf("%d–%d из %d", page.offset+1, page.offset+len(page.deals), page.total)
+	}
+
+	var nav []models.InlineKeyboardButton
+	if page.offset > 0 && len(page.deals) > 0 {
+		nav = append(nav, models.InlineKeyboardButton{Text: "«", CallbackData: encodeHistoryCursor("prev", page.offset, page.deals[0])})
+	}
+	nav = append(nav, models.InlineKeyboardButton{Text: position, CallbackData: historyCallbackPrefix + "nop"})
+	if page.hasNext {
+		nav = append(nav, models.InlineKeyboardButton{Text: "»", CallbackData: encodeHistoryCursor("next", page.offset+len(page.deals), page.deals[len(page.deals)-1])})
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for i, deal := range page.deals {
+		n := strconv.Itoa(page.offset + i + 1)
+		dealID := strconv.FormatInt(deal.ID, 10)
+
+		row := []models.InlineKeyboardButton{{Text: "📎 " + n, CallbackData: mediaCallbackPrefix + "attach:" + dealID}}
+		if deal.AttachmentCount > 0 {
+			row = append(row, models.InlineKeyboardButton{Text: fmt.Sprintf("Скриншоты %s (%d)", n, deal.AttachmentCount), CallbackData: mediaCallbackPrefix + "show:" + dealID})
+		}
+		keyboard = append(keyboard, row)
+	}
+
+	keyboard = append(keyboard,
+		nav,
+		[]models.InlineKeyboardButton{
+			{Text: "Перейти к дате", CallbackData: historyCallbackPrefix + "date"},
+			{Text: "Размер страницы", CallbackData: historyCallbackPrefix + "size"},
+		},
+		[]models.InlineKeyboardButton{
+			{Text: "Фильтр по тегу", CallbackData: historyCallbackPrefix + "tag"},
+			{Text: "Excel", CallbackData: historyCallbackPrefix + "xlsx"},
+		},
+		[]models.InlineKeyboardButton{
+			{Text: "Закрыть", CallbackData: historyCallbackPrefix + "close"},
+		},
+	)
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// showHistoryPage отправляет страницу истории новым сообщением или,
+// если передан messageID, редактирует уже показанную страницу.
+func showHistoryPage(ctx context.Context, b *bot.Bot, chatID int64, messageID int, page *historyPage) error {
+	if messageID == 0 {
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        buildHistoryText(page),
+			ParseMode:   models.ParseModeMarkdown,
+			ReplyMarkup: buildHistoryKeyboard(page),
+		})
+		return err
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		Text:        buildHistoryText(page),
+		ParseMode:   models.ParseModeMarkdown,
+		ReplyMarkup: buildHistoryKeyboard(page),
+	})
+	return err
+}
+
+func historyCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 || update.CallbackQuery.Message.Message == nil {
+		return
+	}
+	messageID := update.CallbackQuery.Message.Message.ID
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, historyCallbackPrefix), ":")
+	size := getUserHistoryPageSize(chatID)
+
+	switch action {
+	case "next", "prev":
+		offset, cursor, err := decodeHistoryCursor(args)
+		if err != nil {
+			log.Println("Error decoding history cursor: ", err)
+			return
+		}
+
+		page, err := loadHistoryPage(chatID, usersHistoryFilter[chatID], size, cursor, offset, action == "prev")
+		if err != nil {
+			log.Println("Error getting deals: ", err)
+			return
+		}
+
+		if err := showHistoryPage(ctx, b, chatID, messageID, page); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	case "size":
+		if args == "" {
+			var row []models.InlineKeyboardButton
+			for _, s := range historyPageSizes {
+				row = append(row, models.InlineKeyboardButton{Text: strconv.Itoa(s), CallbackData: historyCallbackPrefix + "size:" + strconv.Itoa(s)})
+			}
+
+			if _, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+				ChatID:      chatID,
+				MessageID:   messageID,
+				ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}},
+			}); err != nil {
+				log.Printf("can't edit message for %v, error: %v", chatID, err)
+			}
+			return
+		}
+
+		newSize, err := strconv.Atoi(args)
+		if err != nil || !slices.Contains(historyPageSizes, newSize) {
+			log.Println("invalid history page size ", args)
+			return
+		}
+
+		if err := Repository.setHistoryPageSize(chatID, newSize); err != nil {
+			log.Println("Error saving history page size: ", err)
+			return
+		}
+
+		page, err := loadHistoryPage(chatID, usersHistoryFilter[chatID], newSize, nil, 0, false)
+		if err != nil {
+			log.Println("Error getting deals: ", err)
+			return
+		}
+
+		if err := showHistoryPage(ctx, b, chatID, messageID, page); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	case "tag":
+		if args == "" {
+			tags, err := Repository.getTags(chatID, maxTagButtons)
+			if err != nil {
+				log.Println("Error getting tags: ", err)
+				return
+			}
+
+			var keyboard [][]models.InlineKeyboardButton
+			for _, tag := range tags {
+				keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "#" + tag.Name, CallbackData: historyCallbackPrefix + "tag:" + strconv.FormatInt(tag.ID, 10)}})
+			}
+			keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Все сделки", CallbackData: historyCallbackPrefix + "tag:0"}})
+
+			if _, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+				ChatID:      chatID,
+				MessageID:   messageID,
+				ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+			}); err != nil {
+				log.Printf("can't edit message for %v, error: %v", chatID, err)
+			}
+			return
+		}
+
+		tagID, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid tag id ", args)
+			return
+		}
+
+		filter := usersHistoryFilter[chatID]
+		filter.TagID = tagID
+		usersHistoryFilter[chatID] = filter
+
+		page, err := loadHistoryPage(chatID, filter, size, nil, 0, false)
+		if err != nil {
+			log.Println("Error getting deals: ", err)
+			return
+		}
+
+		if err := showHistoryPage(ctx, b, chatID, messageID, page); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	case "date":
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Введите дату в формате ДД-ММ-ГГГГ:",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+			return
+		}
+
+		usersStates[chatID] = StateAwaitingHistoryDate
+		log.Printf("update user %v state for %v  ", chatID, StateAwaitingHistoryDate)
+	case "xlsx":
+		sendDealsXLSX(ctx, b, chatID, usersHistoryFilter[chatID])
+	case "close":
+		if _, err := b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+			ChatID:    chatID,
+			MessageID: messageID,
+		}); err != nil {
+			log.Printf("can't delete message for %v, error: %v", chatID, err)
+		}
+	}
+}
+
+func handleHistoryDate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	date, err := time.ParseInLocation(dateLayout, strings.TrimSpace(update.Message.Text), getUserLocation(chatID))
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "невалидный формат даты, пример: 04-03-2024",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	// Показываем сделки начиная с конца выбранного дня
+	cursor := &dealCursor{Date: date.AddDate(0, 0, 1).UTC()}
+
+	filter := usersHistoryFilter[chatID]
+	offset, err := Repository.countDeals(chatID, filter, cursor)
+	if err != nil {
+		log.Println("Error counting deals: ", err)
+		return
+	}
+
+	size := getUserHistoryPageSize(chatID)
+	page, err := loadHistoryPage(chatID, filter, size, cursor, offset, false)
+	if err != nil {
+		log.Println("Error getting deals: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка получения истории сделок",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	usersStates[chatID] = StateIdle
+
+	if err := showHistoryPage(ctx, b, chatID, 0, page); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
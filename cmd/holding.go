@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// holdingBucket - диапазон времени удержания [From, To), To == 0 - без верхней границы
+type holdingBucket struct {
+	Name string
+	From time.Duration
+	To   time.Duration
+}
+
+var holdingBuckets = []holdingBucket{
+	{Name: "Минуты (до 1 ч)", From: 0, To: time.Hour},
+	{Name: "Часы (до 1 дня)", From: time.Hour, To: 24 * time.Hour},
+	{Name: "Дни (до 1 недели)", From: 24 * time.Hour, To: 7 * 24 * time.Hour},
+	{Name: "Недели", From: 7 * 24 * time.Hour},
+}
+
+func (h holdingBucket) contains(d time.Duration) bool {
+	return d >= h.From && (h.To == 0 || d < h.To)
+}
+
+func holdingCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	text, err := buildHoldingReport(chatID)
+	if err != nil {
+		log.Println("Error building holding report: ", err)
+		text = "Ошибка получения отчета по удержанию"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func buildHoldingReport(chatID int64) (string, error) {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return "", err
+	}
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	buckets := make([]dealGroupStats, len(holdingBuckets))
+	var winners, losers []*Deal
+	var skipped int
+
+	for _, deal := range deals {
+		holding, ok := deal.holdingTime()
+		if !ok {
+			skipped++
+			continue
+		}
+
+		for i, bucket := range holdingBuckets {
+			if bucket.contains(holding) {
+				buckets[i].add(deal)
+				break
+			}
+		}
+
+		if deal.Profit.IsPositive() {
+			winners = append(winners, deal)
+		} else if deal.Profit.IsNegative() {
+			losers = append(losers, deal)
+		}
+	}
+
+	if skipped == len(deals) {
+		return "Нет сделок с датой входа. Укажите вход при добавлении сделки, чтобы увидеть отчет по удержанию.", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Время удержания ⏱</b> (" + html.EscapeString(accountLabel(account)) + ")\n\n")
+	for i, bucket := range holdingBuckets {
+		if buckets[i].Count == 0 {
+			continue
+		}
+		sb.WriteString("<b>" + bucket.Name + ":</b> " + buckets[i].String() + "\n")
+	}
+
+	sb.WriteString("\n")
+	if holding, ok := averageHolding(winners); ok {
+		sb.WriteString("Среднее удержание прибыльных: " + formatDuration(holding) + "\n")
+	}
+	if holding, ok := averageHolding(losers); ok {
+		sb.WriteString("Среднее удержание убыточных: " + formatDuration(holding) + "\n")
+	}
+
+	if skipped > 0 {
+		sb.WriteString("\n<i>Не учтено сделок без даты входа: " + strconv.Itoa(skipped) + "</i>")
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных шагов журнала сделки
+const journalCallbackPrefix = "/journal:"
+
+const maxNoteLength = 1000
+
+// Мапа сделок, для которых пользователь сейчас заполняет журнал
+var usersPendingJournal = make(map[int64]*Deal)
+
+func journalSkipButton(action string) []models.InlineKeyboardButton {
+	return []models.InlineKeyboardButton{{Text: "Пропустить", CallbackData: journalCallbackPrefix + action}}
+}
+
+// startJournal начинает заполнение журнала для только что сохраненной сделки
+func startJournal(ctx context.Context, b *bot.Bot, chatID int64, deal *Deal) {
+	usersPendingJournal[chatID] = deal
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Напишите заметку к сделке: почему вошли, что пошло так или не так.",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			journalSkipButton("note_skip"),
+		}},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingJournalNote
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingJournalNote)
+}
+
+func handleJournalNote(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	deal := usersPendingJournal[chatID]
+	if deal == nil {
+		usersStates[chatID] = StateIdle
+		return
+	}
+
+	if err := validateNote(update.Message.Text); err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	deal.Note = strings.TrimSpace(update.Message.Text)
+	for _, tag := range parseHashtags(deal.Note) {
+		if !slices.Contains(deal.Tags, tag) {
+			deal.Tags = append(deal.Tags, tag)
+		}
+	}
+
+	askJournalStrategy(ctx, b, chatID)
+}
+
+func askJournalStrategy(ctx context.Context, b *bot.Bot, chatID int64) {
+	// Стратегия уже выбрана при добавлении сделки
+	if deal := usersPendingJournal[chatID]; deal != nil && deal.StrategyID != 0 {
+		usersStates[chatID] = StateIdle
+		askJournalRating(ctx, b, chatID)
+		return
+	}
+
+	strategies, err := Repository.getStrategies(chatID)
+	if err != nil {
+		log.Println("Error getting strategies: ", err)
+		return
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, strategy := range strategies {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: strategy.Name, CallbackData: journalCallbackPrefix + "strategy:" + strconv.FormatInt(strategy.ID, 10)}})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Новый сетап", CallbackData: journalCallbackPrefix + "strategy_new"}})
+	keyboard = append(keyboard, journalSkipButton("strategy_skip"))
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Выберите сетап/стратегию сделки:",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateIdle
+}
+
+func handleJournalStrategy(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	deal := usersPendingJournal[chatID]
+	if deal == nil {
+		usersStates[chatID] = StateIdle
+		return
+	}
+
+	name := strings.TrimSpace(update.Message.Text)
+	if err := validateStrategyName(name); err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	id, err := Repository.saveStrategy(chatID, name)
+	if err != nil {
+		log.Println("Error saving strategy: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка сохранения сетапа",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	deal.StrategyID = id
+	deal.Strategy = name
+
+	usersStates[chatID] = StateIdle
+	askJournalRating(ctx, b, chatID)
+}
+
+func askJournalRating(ctx context.Context, b *bot.Bot, chatID int64) {
+	var row []models.InlineKeyboardButton
+	for i := 1; i <= 5; i++ {
+		row = append(row, models.InlineKeyboardButton{Text: strconv.Itoa(i), CallbackData: journalCallbackPrefix + "rate:" + strconv.Itoa(i)})
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Оцените качество исполнения сделки от 1 до 5:",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			row,
+			journalSkipButton("rate_skip"),
+		}},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func askJournalEmotion(ctx context.Context, b *bot.Bot, chatID int64) {
+	var keyboard [][]models.InlineKeyboardButton
+	for i := 0; i < len(emotions); i += 2 {
+		var row []models.InlineKeyboardButton
+		for j := i; j < min(i+2, len(emotions)); j++ {
+			row = append(row, models.InlineKeyboardButton{Text: emotions[j], CallbackData: journalCallbackPrefix + "emotion:" + strconv.Itoa(j)})
+		}
+		keyboard = append(keyboard, row)
+	}
+	keyboard = append(keyboard, journalSkipButton("emotion_skip"))
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Какое у вас было эмоциональное состояние?",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func finishJournal(ctx context.Context, b *bot.Bot, chatID int64) {
+	deal := usersPendingJournal[chatID]
+	if deal == nil {
+		return
+	}
+	delete(usersPendingJournal, chatID)
+
+	if err := Repository.saveDealJournal(deal, chatID); err != nil {
+		log.Println("Error saving deal journal: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка сохранения журнала сделки",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	text := "<b>Журнал сделки сохранен 📝</b>\n" + formatJournalHTML(deal)
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func journalCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, journalCallbackPrefix), ":")
+
+	if action == "start" {
+		dealID, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid deal id ", args)
+			return
+		}
+
+		deal, err := Repository.getDeal(chatID, dealID)
+		if err != nil || deal == nil {
+			log.Println("Error getting deal: ", err)
+			return
+		}
+
+		startJournal(ctx, b, chatID, deal)
+		return
+	}
+
+	deal := usersPendingJournal[chatID]
+	if deal == nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Журнал для этой сделки уже заполнен или отменен",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	switch action {
+	case "note_skip":
+		askJournalStrategy(ctx, b, chatID)
+	case "strategy":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid strategy id ", args)
+			return
+		}
+
+		strategies, err := Repository.getStrategies(chatID)
+		if err != nil {
+			log.Println("Error getting strategies: ", err)
+			return
+		}
+		for _, strategy := range strategies {
+			if strategy.ID == id {
+				deal.StrategyID = strategy.ID
+				deal.Strategy = strategy.Name
+			}
+		}
+
+		askJournalRating(ctx, b, chatID)
+	case "strategy_new":
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Введите название сетапа (напр. Пробой уровня):",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+			return
+		}
+
+		usersStates[chatID] = StateAwaitingJournalStrategy
+		log.Printf("update user %v state for %v  ", chatID, StateAwaitingJournalStrategy)
+	case "strategy_skip":
+		askJournalRating(ctx, b, chatID)
+	case "rate":
+		rating, err := strconv.Atoi(args)
+		if err != nil || rating < 1 || rating > 5 {
+			log.Println("invalid execution rating ", args)
+			return
+		}
+		deal.ExecutionRating = rating
+
+		askJournalEmotion(ctx, b, chatID)
+	case "rate_skip":
+		askJournalEmotion(ctx, b, chatID)
+	case "emotion":
+		i, err := strconv.Atoi(args)
+		if err != nil || i < 0 || i >= len(emotions) {
+			log.Println("invalid emotion ", args)
+			return
+		}
+		deal.Emotion = emotions[i]
+
+		askJournalTags(ctx, b, chatID)
+	case "emotion_skip":
+		askJournalTags(ctx, b, chatID)
+	case "tag":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid tag id ", args)
+			return
+		}
+
+		toggleJournalTag(ctx, b, update, deal, id)
+	case "tags_done":
+		finishJournal(ctx, b, chatID)
+	}
+}
+
+// formatJournal возвращает заполненные поля журнала, по одному на строку
+func formatJournal(deal *Deal) string {
+	var sb strings.Builder
+	if deal.Strategy != "" {
+		sb.WriteString("Сетап: " + deal.Strategy + "\n")
+	}
+	if deal.ExecutionRating > 0 {
+		sb.WriteString(fmt.Sprintf("Исполнение: %d/5\n", deal.ExecutionRating))
+	}
+	if deal.Emotion != "" {
+		sb.WriteString("Эмоции: " + deal.Emotion + "\n")
+	}
+	if deal.Note != "" {
+		sb.WriteString("Заметка: " + deal.Note + "\n")
+	}
+	if len(deal.Tags) > 0 {
+		sb.WriteString("Теги: " + formatTags(deal.Tags) + "\n")
+	}
+
+	return sb.String()
+}
+
+func formatJournalHTML(deal *Deal) string {
+	var sb strings.Builder
+	if deal.Strategy != "" {
+		sb.WriteString("<b>Сетап:</b> " + html.EscapeString(deal.Strategy) + "\n")
+	}
+	if deal.ExecutionRating > 0 {
+		sb.WriteString(fmt.Sprintf("<b>Исполнение:</b> %d/5\n", deal.ExecutionRating))
+	}
+	if deal.Emotion != "" {
+		sb.WriteString("<b>Эмоции:</b> " + deal.Emotion + "\n")
+	}
+	if deal.Note != "" {
+		sb.WriteString("<b>Заметка:</b> " + html.EscapeString(deal.Note) + "\n")
+	}
+	if len(deal.Tags) > 0 {
+		sb.WriteString("<b>Теги:</b> " + html.EscapeString(formatTags(deal.Tags)) + "\n")
+	}
+
+	return sb.String()
+}
+
+func validateNote(note string) error {
+	if strings.TrimSpace(note) == "" {
+		return fmt.Errorf("Введите заметку текстом или нажмите 'Пропустить'")
+	}
+
+	if utf8.RuneCountInString(note) > maxNoteLength {
+		return fmt.Errorf("слишком длинная заметка, максимум %d символов", maxNoteLength)
+	}
+
+	return nil
+}
+
+func validateStrategyName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty strategy")
+	}
+
+	if utf8.RuneCountInString(name) > 40 {
+		return fmt.Errorf("слишком длинное название")
+	}
+
+	return nil
+}
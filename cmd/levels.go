@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных закрытия позиции по стопу или тейку
+const levelsCallbackPrefix = "/levels:"
+
+// Как часто открытые позиции сверяются со стопами и тейками
+const levelsInterval = 30 * time.Second
+
+var levelNames = map[LevelKind]string{
+	LevelStopLoss:   "стоп-лосса",
+	LevelTakeProfit: "тейк-профита",
+}
+
+// levelPrice возвращает цену планового уровня позиции, ноль - уровень не задан
+func levelPrice(deal *Deal, level LevelKind) decimal.Decimal {
+	if level == LevelTakeProfit {
+		return deal.TakeProfit
+	}
+
+	return deal.StopLoss
+}
+
+// reachedLevels возвращает уровни длинной позиции, до которых дошла цена
+func reachedLevels(deal *Deal, price decimal.Decimal) []LevelKind {
+	var levels []LevelKind
+	if !deal.StopLoss.IsZero() && price.LessThanOrEqual(deal.StopLoss) {
+		levels = append(levels, LevelStopLoss)
+	}
+	if !deal.TakeProfit.IsZero() && price.GreaterThanOrEqual(deal.TakeProfit) {
+		levels = append(levels, LevelTakeProfit)
+	}
+
+	return levels
+}
+
+// runLevelWatcher периодически проверяет, не дошла ли цена открытых позиций до стопа или тейка,
+// и завершается вместе с ctx
+func runLevelWatcher(ctx context.Context, b *bot.Bot, source PriceSource) {
+	ticker := time.NewTicker(levelsInterval)
+	defer ticker.Stop()
+
+	for {
+		checkLevels(ctx, b, source)
+
+		select {
+		case <-ctx.Done():
+			log.Println("level watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkLevels(ctx context.Context, b *bot.Bot, source PriceSource) {
+	users, err := Repository.getLevelWatchUsers()
+	if err != nil {
+		log.Println("Error getting users with open positions: ", err)
+		return
+	}
+
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return
+		}
+
+		checkUserLevels(ctx, b, source, userID)
+	}
+}
+
+func checkUserLevels(ctx context.Context, b *bot.Bot, source PriceSource, userID int64) {
+	positions, err := Repository.getOpenPositions(userID)
+	if err != nil {
+		log.Println("Error getting open positions: ", err)
+		return
+	}
+
+	hits, err := Repository.getLevelHits(userID)
+	if err != nil {
+		log.Println("Error getting level hits: ", err)
+		return
+	}
+
+	pairs := make([]string, 0, len(positions))
+	for _, position := range positions {
+		pairs = append(pairs, normalizePair(position.Pair))
+	}
+
+	prices, err := source.Prices(ctx, pairs)
+	if err != nil {
+		log.Println("Error getting prices: ", err)
+		return
+	}
+
+	for _, position := range positions {
+		price, ok := prices[normalizePair(position.Pair)]
+		if !ok {
+			continue
+		}
+
+		for _, level := range reachedLevels(position, price) {
+			if hits[position.ID][level] {
+				continue
+			}
+
+			// Сначала запоминаем уровень, чтобы не спрашивать повторно, если сообщение отправится с ошибкой
+			saved, err := Repository.saveLevelHit(position.ID, level, price, time.Now())
+			if err != nil {
+				log.Println("Error saving level hit: ", err)
+				continue
+			}
+			if saved {
+				askCloseByLevel(ctx, b, userID, position, level, price)
+			}
+		}
+	}
+}
+
+func askCloseByLevel(ctx context.Context, b *bot.Bot, chatID int64, deal *Deal, level LevelKind, price decimal.Decimal) {
+	dealID := strconv.FormatInt(deal.ID, 10)
+
+	// Закрыть можно только по достигнутому уровню, иначе стоп мог бы записаться по цене тейка
+	closeText := "Закрыть по стопу"
+	if level == LevelTakeProfit {
+		closeText = "Закрыть по тейку"
+	}
+	row := []models.InlineKeyboardButton{{Text: closeText, CallbackData: levelsCallbackPrefix + "close:" + dealID + ":" + string(level)}}
+
+	text := "⚠️ <b>" + html.EscapeString(deal.Pair) + "</b>: цена " + price.String() + " дошла до " + levelNames[level] + " " + levelPrice(deal, level).String() + "\n" +
+		"Количество: " + deal.Amount.String() + "\nПокупка: " + deal.BuyPrice.String() + "$"
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			row,
+			{{Text: "Игнорировать", CallbackData: levelsCallbackPrefix + "ignore:" + dealID}},
+		}},
+	}); err != nil {
+		log.Printf("can't send level hit to %v, error: %v", chatID, err)
+	}
+}
+
+func levelsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	// Кнопки больше не нужны, какой бы вариант ни выбрал пользователь
+	if messageID := getMessageID(update); messageID != 0 {
+		if _, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+			ChatID:    chatID,
+			MessageID: messageID,
+		}); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, levelsCallbackPrefix), ":")
+
+	switch action {
+	case "close":
+		id, level, _ := strings.Cut(args, ":")
+		dealID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			log.Println("invalid deal id ", id)
+			return
+		}
+
+		deal, err := Repository.getDeal(chatID, dealID)
+		if err != nil || deal == nil {
+			log.Println("Error getting deal: ", err)
+			return
+		}
+
+		price := levelPrice(deal, LevelKind(level))
+		if !deal.Open || price.IsZero() {
+			if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "Эта позиция уже закрыта",
+			}); err != nil {
+				log.Println("error sending msg ", chatID, err)
+			}
+			return
+		}
+
+		// Выходом считаем момент, когда цена дошла до уровня, а не нажатие кнопки.
+		// Без сохраненного достижения закрывать по уровню нельзя
+		hitDate, err := Repository.getLevelHitDate(chatID, dealID, LevelKind(level))
+		if err != nil {
+			log.Println("Error getting level hit: ", err)
+			return
+		}
+		if hitDate.IsZero() {
+			if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "Цена не доходила до этого уровня, закройте позицию вручную в /positions",
+			}); err != nil {
+				log.Println("error sending msg ", chatID, err)
+			}
+			return
+		}
+
+		deal.SellPrice = price
+		deal.Date = hitDate
+
+		// completeDeal сбрасывает незаконченную сделку, а пользователь мог быть в середине добавления другой
+		pending := usersPendingDeal[chatID]
+		completeDeal(ctx, b, chatID, deal)
+		usersPendingDeal[chatID] = pending
+	case "ignore":
+		// Уровень уже сохранен как достигнутый, повторно бот о нем не спросит
+	}
+}
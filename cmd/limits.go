@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных лимитов торговли
+const limitsCallbackPrefix = "/limits:"
+
+// Доля дневного лимита убытка, после которой бот предупреждает
+var dailyLossWarningShare = decimal.NewFromFloat(0.8)
+
+// Мапа лимитов, новое значение которых ждем от пользователя
+var usersPendingLimit = make(map[int64]LimitKind)
+
+var limitNames = map[LimitKind]string{
+	LimitDailyLoss:         "Дневной убыток",
+	LimitDailyTrades:       "Сделок в день",
+	LimitConsecutiveLosses: "Убытков подряд",
+}
+
+var limitKinds = []LimitKind{LimitDailyLoss, LimitDailyTrades, LimitConsecutiveLosses}
+
+// limitBreachStats - сколько раз лимит был нарушен и в сколько разных дней
+type limitBreachStats struct {
+	Count int
+	Days  int
+}
+
+// limitCheck - результат проверки одного лимита после сделки
+type limitCheck struct {
+	Kind LimitKind
+	// Stop - лимит исчерпан, на сегодня торговлю нужно прекратить
+	Stop bool
+	// Breach - лимит нарушен, событие сохраняется для статистики
+	Breach bool
+	Text   string
+}
+
+func (l TradingLimits) enabled() bool {
+	return l.MaxDailyLoss.IsPositive() || l.MaxDailyTrades > 0 || l.MaxConsecutiveLosses > 0
+}
+
+// sameDay сравнивает календарные дни в часовом поясе пользователя
+func sameDay(a, b time.Time, loc *time.Location) bool {
+	ay, am, ad := a.In(loc).Date()
+	by, bm, bd := b.In(loc).Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// checkLimits проверяет лимиты за день now по закрытым сделкам, отсортированным от новых к старым.
+// Проверка запускается сохранением сделки dealID: если она внесена задним числом за прошлый день,
+// это не повод останавливать торговлю сегодня.
+func checkLimits(limits TradingLimits, deals []*Deal, dealID int64, now time.Time, loc *time.Location) []limitCheck {
+	index := slices.IndexFunc(deals, func(d *Deal) bool { return d.ID == dealID })
+	if index < 0 || !sameDay(deals[index].Date, now, loc) {
+		return nil
+	}
+
+	var checks []limitCheck
+
+	var dayTrades int
+	var dayPnL decimal.Decimal
+	for _, deal := range deals {
+		if sameDay(deal.Date, now, loc) {
+			dayTrades++
+			dayPnL = dayPnL.Add(deal.Profit)
+		}
+	}
+
+	if limit := limits.MaxDailyLoss; limit.IsPositive() && dayPnL.IsNegative() {
+		loss := dayPnL.Neg()
+		switch {
+		case loss.GreaterThanOrEqual(limit):
+			checks = append(checks, limitCheck{Kind: LimitDailyLoss, Stop: true, Breach: true,
+				Text: "убыток за день " + loss.Truncate(3).String() + "$ при лимите " + limit.String() + "$"})
+		case loss.GreaterThanOrEqual(limit.Mul(dailyLossWarningShare)):
+			checks = append(checks, limitCheck{Kind: LimitDailyLoss,
+				Text: "убыток за день " + loss.Truncate(3).String() + "$, до лимита осталось " + limit.Sub(loss).Truncate(3).String() + "$"})
+		}
+	}
+
+	// Последняя разрешенная сделка исчерпывает лимит, нарушением считаются сделки сверх него
+	if limit := limits.MaxDailyTrades; limit > 0 {
+		switch {
+		case dayTrades > limit:
+			checks = append(checks, limitCheck{Kind: LimitDailyTrades, Stop: true, Breach: true,
+				Text: fmt.Sprintf("сделок за день %d при лимите %d", dayTrades, limit)})
+		case dayTrades == limit:
+			checks = append(checks, limitCheck{Kind: LimitDailyTrades, Stop: true,
+				Text: fmt.Sprintf("это была последняя сделка на сегодня (%d из %d)", dayTrades, limit)})
+		case dayTrades == limit-1:
+			checks = append(checks, limitCheck{Kind: LimitDailyTrades,
+				Text: fmt.Sprintf("осталась одна сделка на сегодня (%d из %d)", dayTrades, limit)})
+		}
+	}
+
+	if limit := limits.MaxConsecutiveLosses; limit > 0 {
+		streak := lossStreak(deals, index, now, loc)
+
+		switch {
+		case streak >= limit:
+			checks = append(checks, limitCheck{Kind: LimitConsecutiveLosses, Stop: true, Breach: true,
+				Text: fmt.Sprintf("%d убыточных сделок подряд при лимите %d", streak, limit)})
+		case streak > 0 && streak == limit-1:
+			checks = append(checks, limitCheck{Kind: LimitConsecutiveLosses,
+				Text: fmt.Sprintf("%d убыточных сделок подряд, еще одна - и лимит будет исчерпан", streak)})
+		}
+	}
+
+	return checks
+}
+
+// lossStreak возвращает длину серии убыточных сделок за день now, в которую входит сделка deals[index].
+// Сделка могла быть внесена задним числом, поэтому серия продолжается и в более новые сделки.
+// Вчерашние убытки не запрещают торговать сегодня.
+func lossStreak(deals []*Deal, index int, now time.Time, loc *time.Location) int {
+	losing := func(i int) bool {
+		return i >= 0 && i < len(deals) && sameDay(deals[i].Date, now, loc) && deals[i].Profit.IsNegative()
+	}
+	if !losing(index) {
+		return 0
+	}
+
+	streak := 1
+	for i := index - 1; losing(i); i-- {
+		streak++
+	}
+	for i := index + 1; losing(i); i++ {
+		streak++
+	}
+
+	return streak
+}
+
+// enforceLimits проверяет лимиты после сохранения сделки, предупреждает пользователя и записывает нарушения
+func enforceLimits(ctx context.Context, b *bot.Bot, chatID int64, deal *Deal) {
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		log.Println("Error getting user: ", err)
+		return
+	}
+
+	if !user.Limits.enabled() {
+		return
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		log.Println("Error getting deals: ", err)
+		return
+	}
+
+	now := time.Now()
+	checks := checkLimits(user.Limits, deals, deal.ID, now, userLocation(user.Timezone))
+	if len(checks) == 0 {
+		return
+	}
+
+	var stop bool
+	var sb strings.Builder
+	for _, check := range checks {
+		if check.Breach {
+			if err := Repository.saveLimitBreach(chatID, check.Kind, deal.ID, now); err != nil {
+				log.Println("Error saving limit breach: ", err)
+			}
+		}
+		stop = stop || check.Stop
+		sb.WriteString("• " + limitNames[check.Kind] + ": " + check.Text + "\n")
+	}
+
+	text := "⚠️ <b>Внимание, лимиты близко</b>\n" + sb.String()
+	if stop {
+		text = "⛔ <b>Стоп на сегодня</b>\n" + sb.String() + "\nЛимиты исчерпаны — лучше прекратить торговлю до завтра."
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func formatLimit(limits TradingLimits, kind LimitKind) string {
+	switch kind {
+	case LimitDailyLoss:
+		if limits.MaxDailyLoss.IsPositive() {
+			return limits.MaxDailyLoss.String() + "$"
+		}
+	case LimitDailyTrades:
+		if limits.MaxDailyTrades > 0 {
+			return strconv.Itoa(limits.MaxDailyTrades)
+		}
+	case LimitConsecutiveLosses:
+		if limits.MaxConsecutiveLosses > 0 {
+			return strconv.Itoa(limits.MaxConsecutiveLosses)
+		}
+	}
+
+	return "не задан"
+}
+
+// buildBreachStats - блок статистики с нарушениями лимитов, пустой если нарушений не было
+func buildBreachStats(chatID int64) (string, error) {
+	breaches, err := Repository.getLimitBreaches(chatID)
+	if err != nil || len(breaches) == 0 {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n<b>Нарушения лимитов:</b>\n")
+	for _, kind := range limitKinds {
+		if stats, ok := breaches[kind]; ok {
+			sb.WriteString(fmt.Sprintf("%s: %d раз, дней с нарушением %d\n", limitNames[kind], stats.Count, stats.Days))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func limitsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		log.Println("Error getting user: ", err)
+		return
+	}
+
+	text := "<b>Лимиты торговли 🛑</b>\n"
+	var keyboard [][]models.InlineKeyboardButton
+	for _, kind := range limitKinds {
+		text += limitNames[kind] + ": " + formatLimit(user.Limits, kind) + "\n"
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: limitNames[kind], CallbackData: limitsCallbackPrefix + "set:" + string(kind)}})
+	}
+
+	breaches, err := buildBreachStats(chatID)
+	if err != nil {
+		log.Println("Error getting limit breaches: ", err)
+	}
+	text += breaches
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func limitsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, limitsCallbackPrefix), ":")
+	kind := LimitKind(args)
+	if action != "set" || limitNames[kind] == "" {
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   limitNames[kind] + ": введите новое значение или 0, чтобы отключить лимит",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersPendingLimit[chatID] = kind
+	usersStates[chatID] = StateAwaitingLimitValue
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingLimitValue)
+}
+
+func handleLimitValue(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	kind, ok := usersPendingLimit[chatID]
+	if chatID == 0 || update.Message == nil || !ok {
+		return
+	}
+
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		log.Println("Error getting user: ", err)
+		return
+	}
+	limits := user.Limits
+
+	text := strings.TrimSpace(update.Message.Text)
+	if kind == LimitDailyLoss {
+		var loss decimal.Decimal
+		loss, err = validatePrice(text)
+		limits.MaxDailyLoss = loss
+	} else {
+		var n int
+		n, err = strconv.Atoi(text)
+		if err != nil || n < 0 {
+			err = fmt.Errorf("введите целое число не меньше нуля")
+		}
+		if kind == LimitDailyTrades {
+			limits.MaxDailyTrades = n
+		} else {
+			limits.MaxConsecutiveLosses = n
+		}
+	}
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if err := Repository.setLimits(chatID, limits); err != nil {
+		log.Println("Error saving limits: ", err)
+		return
+	}
+
+	delete(usersPendingLimit, chatID)
+	usersStates[chatID] = StateIdle
+
+	limitsCommand(ctx, b, update)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCheckLimits(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	now := time.Date(2024, 4, 15, 18, 0, 0, 0, loc)
+	today := func(hour int) time.Time { return time.Date(2024, 4, 15, hour, 0, 0, 0, loc) }
+	yesterday := func(hour int) time.Time { return time.Date(2024, 4, 14, hour, 0, 0, 0, loc) }
+
+	deal := func(id int64, date time.Time, profit int64) *Deal {
+		return &Deal{ID: id, Date: date, Profit: decimal.NewFromInt(profit)}
+	}
+
+	type wantCheck struct {
+		kind         LimitKind
+		stop, breach bool
+	}
+
+	tests := []struct {
+		name   string
+		limits TradingLimits
+		deals  []*Deal // от новых к старым, как отдает getDeals
+		dealID int64   // только что сохраненная сделка, 0 - deals[0]
+		want   []wantCheck
+	}{
+		{
+			name:   "daily loss reached",
+			limits: TradingLimits{MaxDailyLoss: decimal.NewFromInt(100)},
+			deals:  []*Deal{deal(1, today(12), -60), deal(2, today(10), -50)},
+			want:   []wantCheck{{kind: LimitDailyLoss, stop: true, breach: true}},
+		},
+		{
+			name:   "daily loss warning",
+			limits: TradingLimits{MaxDailyLoss: decimal.NewFromInt(100)},
+			deals:  []*Deal{deal(1, today(12), -85)},
+			want:   []wantCheck{{kind: LimitDailyLoss}},
+		},
+		{
+			name:   "yesterday loss is not counted",
+			limits: TradingLimits{MaxDailyLoss: decimal.NewFromInt(100)},
+			deals:  []*Deal{deal(1, today(12), -10), deal(2, yesterday(15), -500)},
+		},
+		{
+			name:   "last allowed trade",
+			limits: TradingLimits{MaxDailyTrades: 2},
+			deals:  []*Deal{deal(1, today(12), 10), deal(2, today(10), 10), deal(3, yesterday(10), 10)},
+			want:   []wantCheck{{kind: LimitDailyTrades, stop: true}},
+		},
+		{
+			name:   "trades over limit",
+			limits: TradingLimits{MaxDailyTrades: 1},
+			deals:  []*Deal{deal(1, today(12), 10), deal(2, today(10), 10)},
+			want:   []wantCheck{{kind: LimitDailyTrades, stop: true, breach: true}},
+		},
+		{
+			name:   "streak reached",
+			limits: TradingLimits{MaxConsecutiveLosses: 3},
+			deals:  []*Deal{deal(1, today(12), -1), deal(2, today(11), -1), deal(3, today(10), -1), deal(4, today(9), 5)},
+			want:   []wantCheck{{kind: LimitConsecutiveLosses, stop: true, breach: true}},
+		},
+		{
+			name:   "streak stops at midnight",
+			limits: TradingLimits{MaxConsecutiveLosses: 3},
+			deals:  []*Deal{deal(1, today(12), -1), deal(2, today(0), -1), deal(3, yesterday(23), -1)},
+			want:   []wantCheck{{kind: LimitConsecutiveLosses}},
+		},
+		{
+			name:   "streak stops at a win",
+			limits: TradingLimits{MaxConsecutiveLosses: 3},
+			deals:  []*Deal{deal(1, today(12), -1), deal(2, today(11), 1), deal(3, today(10), -1), deal(4, today(9), -1)},
+		},
+		{
+			name:   "winning deal does not report a streak",
+			limits: TradingLimits{MaxConsecutiveLosses: 2},
+			deals:  []*Deal{deal(1, today(12), 5), deal(2, today(11), -1)},
+		},
+		{
+			name:   "backdated loss joins newer losses",
+			limits: TradingLimits{MaxConsecutiveLosses: 3},
+			deals:  []*Deal{deal(1, today(14), -1), deal(2, today(12), -1), deal(3, today(10), -1), deal(4, today(9), 5)},
+			dealID: 2,
+			want:   []wantCheck{{kind: LimitConsecutiveLosses, stop: true, breach: true}},
+		},
+		{
+			name:   "backdated win inside a losing day",
+			limits: TradingLimits{MaxConsecutiveLosses: 2},
+			deals:  []*Deal{deal(1, today(14), -1), deal(2, today(12), -1), deal(3, today(10), 5)},
+			dealID: 3,
+		},
+		{
+			name:   "backdated deal from yesterday",
+			limits: TradingLimits{MaxDailyLoss: decimal.NewFromInt(100), MaxDailyTrades: 1, MaxConsecutiveLosses: 2},
+			deals:  []*Deal{deal(1, today(14), -80), deal(2, today(12), -80), deal(3, yesterday(20), -80)},
+			dealID: 3,
+		},
+		{
+			name:   "unknown deal",
+			limits: TradingLimits{MaxDailyTrades: 1},
+			deals:  []*Deal{deal(1, today(14), 10), deal(2, today(12), 10)},
+			dealID: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dealID := tt.dealID
+			if dealID == 0 {
+				dealID = tt.deals[0].ID
+			}
+
+			got := checkLimits(tt.limits, tt.deals, dealID, now, loc)
+			if len(got) != len(tt.want) {
+				t.Fatalf("checkLimits() = %+v, want %+v", got, tt.want)
+			}
+			for i, w := range tt.want {
+				if got[i].Kind != w.kind || got[i].Stop != w.stop || got[i].Breach != w.breach {
+					t.Errorf("check %d = %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
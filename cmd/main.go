@@ -4,6 +4,8 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	// Встроенная база часовых поясов, чтобы не зависеть от tzdata в контейнере
+	_ "time/tzdata"
 
 	"github.com/go-telegram/bot"
 )
@@ -24,6 +26,37 @@ func main() {
 		bot.WithCallbackQueryDataHandler("/add_pair", bot.MatchTypeExact, addPairCallbackHandler),
 		bot.WithCallbackQueryDataHandler("/add_deal", bot.MatchTypeExact, addDealCallbackHandler),
 		bot.WithCallbackQueryDataHandler("/get_history", bot.MatchTypeExact, getHistoryCallbackHandler),
+		bot.WithCallbackQueryDataHandler(historyCallbackPrefix, bot.MatchTypePrefix, historyCallbackHandler),
+		bot.WithCallbackQueryDataHandler(journalCallbackPrefix, bot.MatchTypePrefix, journalCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/playbook", bot.MatchTypeExact, playbookCommand),
+		bot.WithCallbackQueryDataHandler(playbookCallbackPrefix, bot.MatchTypePrefix, playbookCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/stats", bot.MatchTypeExact, statsCommand),
+		bot.WithCallbackQueryDataHandler("/tags", bot.MatchTypeExact, tagsCommand),
+		bot.WithCallbackQueryDataHandler(mediaCallbackPrefix, bot.MatchTypePrefix, mediaCallbackHandler),
+		bot.WithCallbackQueryDataHandler(riskCallbackPrefix, bot.MatchTypePrefix, riskCallbackHandler),
+		bot.WithCallbackQueryDataHandler(sizeCallbackPrefix, bot.MatchTypePrefix, sizeCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/positions", bot.MatchTypeExact, positionsCommand),
+		bot.WithCallbackQueryDataHandler(positionCallbackPrefix, bot.MatchTypePrefix, positionCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/accounts", bot.MatchTypeExact, accountsCommand),
+		bot.WithCallbackQueryDataHandler(accountCallbackPrefix, bot.MatchTypePrefix, accountCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/limits", bot.MatchTypeExact, limitsCommand),
+		bot.WithCallbackQueryDataHandler(limitsCallbackPrefix, bot.MatchTypePrefix, limitsCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/risk_report", bot.MatchTypeExact, riskReportCommand),
+		bot.WithCallbackQueryDataHandler("/reports", bot.MatchTypeExact, reportsCommand),
+		bot.WithCallbackQueryDataHandler(reportsCallbackPrefix, bot.MatchTypePrefix, reportsCallbackHandler),
+		bot.WithCallbackQueryDataHandler(dateCallbackPrefix, bot.MatchTypePrefix, dateCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/holding", bot.MatchTypeExact, holdingCommand),
+		bot.WithCallbackQueryDataHandler("/heatmap", bot.MatchTypeExact, heatmapCommand),
+		bot.WithCallbackQueryDataHandler("/calendar", bot.MatchTypeExact, calendarCommand),
+		bot.WithCallbackQueryDataHandler(calendarCallbackPrefix, bot.MatchTypePrefix, calendarCallbackHandler),
+		bot.WithCallbackQueryDataHandler(alertCallbackPrefix, bot.MatchTypePrefix, alertCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/portfolio", bot.MatchTypeExact, portfolioCommand),
+		bot.WithCallbackQueryDataHandler(portfolioCallbackPrefix, bot.MatchTypePrefix, portfolioCallbackHandler),
+		bot.WithCallbackQueryDataHandler(levelsCallbackPrefix, bot.MatchTypePrefix, levelsCallbackHandler),
+		bot.WithCallbackQueryDataHandler(pdfReportCallbackPrefix, bot.MatchTypePrefix, pdfReportCallbackHandler),
+		bot.WithCallbackQueryDataHandler("/export", bot.MatchTypeExact, exportCommand),
+		bot.WithCallbackQueryDataHandler(restoreCallbackPrefix, bot.MatchTypePrefix, restoreCallbackHandler),
+		bot.WithCallbackQueryDataHandler(deleteMeCallbackPrefix, bot.MatchTypePrefix, deleteMeCallbackHandler),
 		bot.WithMiddlewares(showMessageWithUserName),
 	}
 
@@ -51,6 +84,60 @@ func main() {
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/add_deal", bot.MatchTypeExact, addDealCallbackHandler)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/add_pair", bot.MatchTypeExact, addPairCallbackHandler)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/get_history", bot.MatchTypeExact, getHistoryCallbackHandler)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/playbook", bot.MatchTypeExact, playbookCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/stats", bot.MatchTypeExact, statsCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/tags", bot.MatchTypeExact, tagsCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/size", bot.MatchTypeExact, sizeCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/positions", bot.MatchTypeExact, positionsCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/accounts", bot.MatchTypeExact, accountsCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/limits", bot.MatchTypeExact, limitsCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/risk_report", bot.MatchTypeExact, riskReportCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/reports", bot.MatchTypeExact, reportsCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/timezone", bot.MatchTypeExact, timezoneCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/holding", bot.MatchTypeExact, holdingCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/heatmap", bot.MatchTypeExact, heatmapCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/calendar", bot.MatchTypeExact, calendarCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/portfolio", bot.MatchTypeExact, portfolioCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/tax", bot.MatchTypePrefix, taxCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/export", bot.MatchTypeExact, exportCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/backup", bot.MatchTypeExact, backupCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/restore", bot.MatchTypeExact, restoreCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/my_data", bot.MatchTypeExact, myDataCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/delete_me", bot.MatchTypeExact, deleteMeCommand)
+	// Пробел в префиксе, чтобы /report с месяцем не перехватывал /reports
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/report", bot.MatchTypeExact, reportCommand)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/report ", bot.MatchTypePrefix, reportCommand)
+	// Префикс ловит и /alert с условием, и /alerts
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/alert", bot.MatchTypePrefix, alertCommand)
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		runScheduler(ctx, b)
+	}()
+
+	// Без источника цен уведомления, стопы и тейки не проверяются
+	alertsDone := make(chan struct{})
+	levelsDone := make(chan struct{})
+	if source := os.Getenv("PRICE_SOURCE"); source != "" {
+		Prices = newPriceSource(source)
+		go func() {
+			defer close(alertsDone)
+			runAlerts(ctx, b, Prices)
+		}()
+		go func() {
+			defer close(levelsDone)
+			runLevelWatcher(ctx, b, Prices)
+		}()
+	} else {
+		close(alertsDone)
+		close(levelsDone)
+	}
 
 	b.Start(ctx)
+
+	// Ждем, пока фоновые задачи допишут текущие сообщения
+	<-schedulerDone
+	<-alertsDone
+	<-levelsDone
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных скриншотов сделки
+const mediaCallbackPrefix = "/media:"
+
+const maxDealAttachments = 20
+
+// Telegram принимает в одном альбоме не больше 10 файлов
+const maxAlbumSize = 10
+
+// Мапа сделок, к которым пользователь сейчас прикрепляет скриншоты из истории
+var usersAttachDeal = make(map[int64]int64)
+
+// attachmentFromMessage достает фото или документ из сообщения, для остальных сообщений возвращает nil
+func attachmentFromMessage(msg *models.Message) *Attachment {
+	if msg == nil {
+		return nil
+	}
+
+	if len(msg.Photo) > 0 {
+		// Последний размер фото самый большой
+		return &Attachment{FileID: msg.Photo[len(msg.Photo)-1].FileID, Kind: AttachmentPhoto}
+	}
+
+	if msg.Document != nil {
+		return &Attachment{FileID: msg.Document.FileID, Kind: AttachmentDocument}
+	}
+
+	return nil
+}
+
+func handleAttachment(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	attachment := attachmentFromMessage(update.Message)
+	if attachment == nil {
+		return
+	}
+
+	var text string
+	switch {
+	case usersStates[chatID] == StateAwaitingDealAttachment:
+		dealID := usersAttachDeal[chatID]
+
+		attachments, err := Repository.getAttachments(chatID, dealID)
+		if err != nil {
+			log.Println("Error getting attachments: ", err)
+			return
+		}
+		if len(attachments) >= maxDealAttachments {
+			text = fmt.Sprintf("К сделке можно прикрепить не больше %d файлов", maxDealAttachments)
+			break
+		}
+
+		attachment.DealID = dealID
+		if err := Repository.saveAttachment(attachment); err != nil {
+			log.Println("Error saving attachment: ", err)
+			text = "Ошибка сохранения скриншота"
+			break
+		}
+		text = fmt.Sprintf("Скриншот прикреплен к сделке (%d) 📎", len(attachments)+1)
+	case usersPendingDeal[chatID] != nil:
+		deal := usersPendingDeal[chatID]
+		if len(deal.Attachments) >= maxDealAttachments {
+			text = fmt.Sprintf("К сделке можно прикрепить не больше %d файлов", maxDealAttachments)
+			break
+		}
+
+		deal.Attachments = append(deal.Attachments, attachment)
+		text = fmt.Sprintf("Скриншот будет сохранен вместе со сделкой (%d) 📎", len(deal.Attachments))
+	default:
+		text = "Чтобы прикрепить скриншот, откройте сделку в истории и нажмите 📎"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+// sendAttachments отправляет вложения сделки альбомами, фото и документы отдельно
+func sendAttachments(ctx context.Context, b *bot.Bot, chatID int64, attachments []*Attachment) error {
+	var photos, documents []*Attachment
+	for _, a := range attachments {
+		if a.Kind == AttachmentPhoto {
+			photos = append(photos, a)
+		} else {
+			documents = append(documents, a)
+		}
+	}
+
+	for _, group := range [][]*Attachment{photos, documents} {
+		for start := 0; start < len(group); start += maxAlbumSize {
+			chunk := group[start:min(start+maxAlbumSize, len(group))]
+			if err := sendAlbum(ctx, b, chatID, chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func sendAlbum(ctx context.Context, b *bot.Bot, chatID int64, attachments []*Attachment) error {
+	// Альбом должен содержать хотя бы два файла
+	if len(attachments) == 1 {
+		a := attachments[0]
+		if a.Kind == AttachmentPhoto {
+			_, err := b.SendPhoto(ctx, &bot.SendPhotoParams{ChatID: chatID, Photo: &models.InputFileString{Data: a.FileID}})
+			return err
+		}
+
+		_, err := b.SendDocument(ctx, &bot.SendDocumentParams{ChatID: chatID, Document: &models.InputFileString{Data: a.FileID}})
+		return err
+	}
+
+	media := make([]models.InputMedia, 0, len(attachments))
+	for _, a := range attachments {
+		if a.Kind == AttachmentPhoto {
+			media = append(media, &models.InputMediaPhoto{Media: a.FileID})
+		} else {
+			media = append(media, &models.InputMediaDocument{Media: a.FileID})
+		}
+	}
+
+	_, err := b.SendMediaGroup(ctx, &bot.SendMediaGroupParams{ChatID: chatID, Media: media})
+	return err
+}
+
+func mediaCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, mediaCallbackPrefix), ":")
+
+	if action == "done" {
+		delete(usersAttachDeal, chatID)
+		usersStates[chatID] = StateIdle
+
+		if err := showStandardButtons(ctx, b, update); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	dealID, err := strconv.ParseInt(args, 10, 64)
+	if err != nil {
+		log.Println("invalid deal id ", args)
+		return
+	}
+
+	switch action {
+	case "attach":
+		deal, err := Repository.getDeal(chatID, dealID)
+		if err != nil || deal == nil {
+			log.Println("Error getting deal: ", err)
+			return
+		}
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Отправьте скриншоты или файлы для сделки " + deal.Pair + " от " + formatDate(deal.Date, getUserLocation(chatID)) + ". Когда закончите, нажмите 'Готово'.",
+			ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: "Готово", CallbackData: mediaCallbackPrefix + "done"}},
+			}},
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+			return
+		}
+
+		usersAttachDeal[chatID] = dealID
+		usersStates[chatID] = StateAwaitingDealAttachment
+		log.Printf("update user %v state for %v  ", chatID, StateAwaitingDealAttachment)
+	case "show":
+		attachments, err := Repository.getAttachments(chatID, dealID)
+		if err != nil {
+			log.Println("Error getting attachments: ", err)
+			return
+		}
+
+		if len(attachments) == 0 {
+			if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "К этой сделке нет скриншотов",
+			}); err != nil {
+				log.Println("error sending msg ", chatID, err)
+			}
+			return
+		}
+
+		if err := sendAttachments(ctx, b, chatID, attachments); err != nil {
+			log.Printf("can't send attachments to %v, error: %v", chatID, err)
+		}
+	}
+}
@@ -15,13 +15,107 @@ const (
 	StateAwaitingAmount
 	StateAwaitingBuyPrice
 	StateAwaitingSellPrice
+	StateAwaitingHistoryDate
+	StateAwaitingJournalNote
+	StateAwaitingJournalStrategy
+	StateAwaitingStrategyName
+	StateAwaitingStrategyDescription
+	StateAwaitingStrategyRules
+	StateAwaitingDealAttachment
+	StateAwaitingStopLoss
+	StateAwaitingTakeProfit
+	StateAwaitingSizeBalance
+	StateAwaitingSizeRisk
+	StateAwaitingSizeEntry
+	StateAwaitingSizeStop
+	StateAwaitingAccountName
+	StateAwaitingAccountBalance
+	StateAwaitingCashFlow
+	StateAwaitingLimitValue
+	StateAwaitingReportHour
+	StateAwaitingTimezone
+	StateAwaitingEntryDate
+	StateAwaitingExitDate
+	StateAwaitingBackupFile
 )
 
 type User struct {
-	Name   string
-	ChatID int64
+	Name            string
+	ChatID          int64
+	HistoryPageSize int
+	Balance         decimal.Decimal // баланс, последний раз введенный в калькуляторе /size
+	// Текущий портфель (счет), с которым работают добавление сделок, история и статистика.
+	// 0 - все портфели сразу
+	CurrentAccountID int64
+	Limits           TradingLimits
+	// Часовой пояс IANA, например Europe/Moscow
+	Timezone string
 }
 
+// TradingLimits - дневные ограничения торговли, нулевые значения отключают лимит
+type TradingLimits struct {
+	MaxDailyLoss         decimal.Decimal
+	MaxDailyTrades       int
+	MaxConsecutiveLosses int
+}
+
+type ReportPeriod string
+
+const (
+	ReportDaily   ReportPeriod = "daily"
+	ReportWeekly  ReportPeriod = "weekly"
+	ReportMonthly ReportPeriod = "monthly"
+)
+
+// ReportSchedule - расписание автоматического отчета. NextRun хранится в UTC
+type ReportSchedule struct {
+	UserID   int64
+	Period   ReportPeriod
+	Hour     int
+	NextRun  time.Time
+	Timezone string
+}
+
+type LimitKind string
+
+const (
+	LimitDailyLoss         LimitKind = "daily_loss"
+	LimitDailyTrades       LimitKind = "daily_trades"
+	LimitConsecutiveLosses LimitKind = "consecutive_losses"
+)
+
+// LimitBreach - нарушение дневного лимита, DealID - сделка, после которой лимит нарушен
+type LimitBreach struct {
+	Kind   LimitKind
+	DealID int64
+	Date   time.Time
+}
+
+type AlertDirection string
+
+const (
+	AlertAbove AlertDirection = "above"
+	AlertBelow AlertDirection = "below"
+)
+
+// PriceAlert - уведомление о пересечении ценой уровня. Срабатывает один раз
+type PriceAlert struct {
+	ID        int64
+	UserID    int64
+	Pair      string
+	Direction AlertDirection
+	Level     decimal.Decimal
+	CreatedAt time.Time
+}
+
+// LevelKind - плановый уровень позиции, при достижении которого бот предлагает ее закрыть
+type LevelKind string
+
+const (
+	LevelStopLoss   LevelKind = "stop"
+	LevelTakeProfit LevelKind = "take"
+)
+
 type Deal struct {
 	Pair          string
 	ID            int64
@@ -31,4 +125,99 @@ type Deal struct {
 	Profit        decimal.Decimal
 	ProfitPercent decimal.Decimal
 	Date          time.Time
+
+	// Позиция еще не закрыта: нет цены продажи и прибыли
+	Open bool
+
+	// Торговый счет сделки, 0 - сделка не привязана к счету
+	AccountID int64
+
+	// Дата входа в сделку, Date - дата выхода. Нулевая, если вход не указан
+	EntryDate time.Time
+	// Вход выбран кнопкой "Сегодня" или "Вчера" и известен только с точностью до дня.
+	// Не сохраняется: нужен, пока сделка заполняется
+	entryApproximate bool
+
+	// Плановые уровни сделки, нулевое значение - уровень не задан
+	StopLoss   decimal.Decimal
+	TakeProfit decimal.Decimal
+
+	// Журнал сделки, заполняется пользователем по желанию
+	Note            string
+	StrategyID      int64
+	Strategy        string
+	ExecutionRating int
+	Emotion         string
+
+	// Отметки о соблюдении правил стратегии: ID правила -> соблюдено ли
+	RuleChecks map[int64]bool
+
+	// Скриншоты графиков, прикрепленные при создании сделки
+	Attachments     []*Attachment
+	AttachmentCount int
+
+	// Теги сделки без решетки, в нижнем регистре
+	Tags []string
+}
+
+type Tag struct {
+	ID   int64
+	Name string
+}
+
+// dealFilter ограничивает выборку сделок в истории, нулевые поля не фильтруют
+type dealFilter struct {
+	TagID     int64
+	AccountID int64
+}
+
+type AttachmentKind string
+
+const (
+	AttachmentPhoto    AttachmentKind = "photo"
+	AttachmentDocument AttachmentKind = "document"
+)
+
+// Attachment хранит telegram file_id файла, прикрепленного к сделке
+type Attachment struct {
+	ID     int64
+	DealID int64
+	FileID string
+	Kind   AttachmentKind
+}
+
+type Account struct {
+	ID              int64
+	Name            string
+	StartingBalance decimal.Decimal
+	CreatedAt       time.Time
+}
+
+// CashFlow - пополнение (Amount > 0) или вывод (Amount < 0) средств со счета
+type CashFlow struct {
+	ID        int64
+	AccountID int64
+	Amount    decimal.Decimal
+	Date      time.Time
+}
+
+type Strategy struct {
+	ID          int64
+	Name        string
+	Description string
+	Rules       []*StrategyRule
+}
+
+type StrategyRule struct {
+	ID   int64
+	Text string
+}
+
+// Эмоциональные состояния, которые трейдер может отметить в журнале
+var emotions = []string{"Спокойствие", "Уверенность", "Страх", "Жадность", "FOMO", "Азарт", "Усталость"}
+
+// dealCursor указывает на позицию сделки в истории, отсортированной по (deal_date, deal_id)
+type dealCursor struct {
+	Date time.Time
+	ID   int64
 }
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"playbook_bot/analytics"
+)
+
+// Префикс callback-данных выбора месяца PDF-отчета
+const pdfReportCallbackPrefix = "/pdf:"
+
+// Сколько последних месяцев предлагается кнопками в /report
+const pdfReportMonths = 6
+
+// Форматы месяца, которые понимает /report: 04-2024, 04.2024, 2024-04
+var pdfMonthLayouts = []string{"01-2006", "2006-01"}
+
+// Размеры страницы A4 в миллиметрах
+const (
+	pdfMargin      = 15.0
+	pdfContentWide = 180.0
+	pdfChartHeight = 60.0
+	pdfLineHeight  = 6.0
+)
+
+// Шрифт с кириллицей, встроенные шрифты PDF ее не поддерживают
+const pdfFont = "go"
+
+var (
+	pdfProfitColor = [3]int{46, 160, 67}
+	pdfLossColor   = [3]int{214, 48, 49}
+)
+
+// monthlyReport - данные PDF-отчета за месяц
+type monthlyReport struct {
+	Month   time.Time
+	Account *Account
+	Deals   []*Deal // закрытые за месяц сделки по дате закрытия
+	Loc     *time.Location
+}
+
+// loadMonthlyReport собирает сделки текущего портфеля, закрытые в месяце month
+func loadMonthlyReport(chatID int64, month time.Time) (*monthlyReport, error) {
+	deals, account, err := loadCalendarDeals(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &monthlyReport{Month: month, Account: account, Loc: month.Location()}
+	next := month.AddDate(0, 1, 0)
+	for _, deal := range deals {
+		if !deal.Date.Before(month) && deal.Date.Before(next) {
+			report.Deals = append(report.Deals, deal)
+		}
+	}
+	sort.SliceStable(report.Deals, func(i, j int) bool {
+		return report.Deals[i].Date.Before(report.Deals[j].Date)
+	})
+
+	return report, nil
+}
+
+func (r *monthlyReport) title() string {
+	return calendarMonths[r.Month.Month()-1] + " " + fmt.Sprint(r.Month.Year())
+}
+
+func pdfSetColor(pdf *fpdf.Fpdf, pnl decimal.Decimal) {
+	switch {
+	case pnl.IsPositive():
+		pdf.SetTextColor(pdfProfitColor[0], pdfProfitColor[1], pdfProfitColor[2])
+	case pnl.IsNegative():
+		pdf.SetTextColor(pdfLossColor[0], pdfLossColor[1], pdfLossColor[2])
+	default:
+		pdf.SetTextColor(0, 0, 0)
+	}
+}
+
+func pdfHeading(pdf *fpdf.Fpdf, text string) {
+	pdf.Ln(4)
+	pdf.SetFont(pdfFont, "B", 13)
+	pdf.CellFormat(0, 8, text, "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 10)
+}
+
+func pdfTableHeader(pdf *fpdf.Fpdf, widths []float64, titles []string) {
+	pdf.SetFont(pdfFont, "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	for i, title := range titles {
+		pdf.CellFormat(widths[i], pdfLineHeight, title, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont(pdfFont, "", 9)
+}
+
+// pdfEquityChart рисует накопленный за месяц P&L после каждой сделки
+func pdfEquityChart(pdf *fpdf.Fpdf, deals []*Deal) {
+	curve := append([]float64{0}, analytics.EquityCurve(0, analyticsTrades(deals))...)
+
+	low, high := 0.0, 0.0
+	for _, v := range curve {
+		low = min(low, v)
+		high = max(high, v)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	x0, y0 := pdfMargin, pdf.GetY()
+	chartX := x0 + 20
+	chartWide := pdfContentWide - 20
+	toY := func(v float64) float64 {
+		return y0 + pdfChartHeight - (v-low)/(high-low)*pdfChartHeight
+	}
+
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.Rect(chartX, y0, chartWide, pdfChartHeight, "D")
+	pdf.Line(chartX, toY(0), chartX+chartWide, toY(0))
+
+	pdf.SetFont(pdfFont, "", 8)
+	pdf.Text(x0, toY(high)+3, fmt.Sprintf("%.2f", high))
+	pdf.Text(x0, toY(low), fmt.Sprintf("%.2f", low))
+	pdf.Text(x0, toY(0)+1, "0")
+
+	pdf.SetDrawColor(40, 90, 200)
+	pdf.SetLineWidth(0.5)
+	step := chartWide / float64(max(len(curve)-1, 1))
+	for i := 1; i < len(curve); i++ {
+		pdf.Line(chartX+float64(i-1)*step, toY(curve[i-1]), chartX+float64(i)*step, toY(curve[i]))
+	}
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+
+	pdf.SetY(y0 + pdfChartHeight + 2)
+	pdf.SetFont(pdfFont, "", 10)
+}
+
+// renderMonthlyReportPDF собирает отчет: итоги, кривая P&L, таблица по парам и список сделок
+func renderMonthlyReportPDF(report *monthlyReport) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(pdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", gobold.TTF)
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.AddPage()
+
+	pdf.SetFont(pdfFont, "B", 16)
+	pdf.CellFormat(0, 10, "Торговый отчет: "+report.title(), "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 10)
+	pdf.CellFormat(0, pdfLineHeight, "Портфель: "+accountLabel(report.Account)+", часовой пояс "+report.Loc.String(), "", 1, "L", false, 0, "")
+
+	var total dealGroupStats
+	var best, worst *Deal
+	byPair := make(map[string]*dealGroupStats)
+	for _, deal := range report.Deals {
+		total.add(deal)
+		if byPair[deal.Pair] == nil {
+			byPair[deal.Pair] = &dealGroupStats{}
+		}
+		byPair[deal.Pair].add(deal)
+
+		if best == nil || deal.Profit.GreaterThan(best.Profit) {
+			best = deal
+		}
+		if worst == nil || deal.Profit.LessThan(worst.Profit) {
+			worst = deal
+		}
+	}
+
+	pdfHeading(pdf, "Итоги")
+	if total.Count == 0 {
+		pdf.CellFormat(0, pdfLineHeight, "В этом месяце закрытых сделок не было", "", 1, "L", false, 0, "")
+		return pdfBytes(pdf)
+	}
+
+	drawdown := analytics.MaxDrawdown(0, analyticsTrades(report.Deals))
+	summary := []string{
+		fmt.Sprintf("Сделок: %d, прибыльных: %d, винрейт: %s%%", total.Count, total.Wins, total.winRate().String()),
+		"P&L за месяц: " + total.PnL.Truncate(2).String() + "$",
+		"Средний результат сделки: " + total.PnL.Div(decimal.NewFromInt(int64(total.Count))).Truncate(2).String() + "$",
+		"Лучшая сделка: " + best.Pair + " " + best.Profit.Truncate(2).String() + "$",
+		"Худшая сделка: " + worst.Pair + " " + worst.Profit.Truncate(2).String() + "$",
+		fmt.Sprintf("Максимальная просадка: %.2f$", drawdown.Amount),
+	}
+	for _, line := range summary {
+		pdf.CellFormat(0, pdfLineHeight, line, "", 1, "L", false, 0, "")
+	}
+
+	pdfHeading(pdf, "Накопленный P&L")
+	pdfEquityChart(pdf, report.Deals)
+
+	pdfHeading(pdf, "По парам")
+	pairs := make([]string, 0, len(byPair))
+	for pair := range byPair {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	pairWidths := []float64{60, 30, 40, 50}
+	pdfTableHeader(pdf, pairWidths, []string{"Пара", "Сделок", "Винрейт", "P&L"})
+	for _, pair := range pairs {
+		stats := byPair[pair]
+		pdf.CellFormat(pairWidths[0], pdfLineHeight, pair, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(pairWidths[1], pdfLineHeight, fmt.Sprint(stats.Count), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(pairWidths[2], pdfLineHeight, stats.winRate().String()+"%", "1", 0, "R", false, 0, "")
+		pdfSetColor(pdf, stats.PnL)
+		pdf.CellFormat(pairWidths[3], pdfLineHeight, stats.PnL.Truncate(2).String()+"$", "1", 1, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+
+	pdfHeading(pdf, "Сделки")
+	dealWidths := []float64{32, 33, 23, 25, 25, 24, 18}
+	pdfTableHeader(pdf, dealWidths, []string{"Закрыта", "Пара", "Кол-во", "Покупка", "Продажа", "P&L", "%"})
+	for _, deal := range report.Deals {
+		pdf.CellFormat(dealWidths[0], pdfLineHeight, formatDateTime(deal.Date, report.Loc), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(dealWidths[1], pdfLineHeight, deal.Pair, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(dealWidths[2], pdfLineHeight, deal.Amount.String(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(dealWidths[3], pdfLineHeight, deal.BuyPrice.String(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(dealWidths[4], pdfLineHeight, deal.SellPrice.String(), "1", 0, "R", false, 0, "")
+		pdfSetColor(pdf, deal.Profit)
+		pdf.CellFormat(dealWidths[5], pdfLineHeight, deal.Profit.Truncate(2).String(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(dealWidths[6], pdfLineHeight, deal.ProfitPercent.Truncate(2).String(), "1", 1, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+
+	return pdfBytes(pdf)
+}
+
+func pdfBytes(pdf *fpdf.Fpdf) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseReportMonth разбирает месяц отчета в часовом поясе loc
+func parseReportMonth(text string, loc *time.Location) (time.Time, error) {
+	text = strings.NewReplacer(".", "-", "/", "-").Replace(strings.TrimSpace(text))
+	for _, layout := range pdfMonthLayouts {
+		if month, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return month, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("не понял месяц, пример: /report 04-2024")
+}
+
+func sendMonthlyReport(ctx context.Context, b *bot.Bot, chatID int64, month time.Time) {
+	report, err := loadMonthlyReport(chatID, month)
+	if err != nil {
+		log.Println("Error getting deals: ", err)
+		return
+	}
+
+	data, err := renderMonthlyReportPDF(report)
+	if err != nil {
+		log.Println("Error building pdf report: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Не удалось собрать отчет",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: "report_" + month.Format("2006-01") + ".pdf", Data: bytes.NewReader(data)},
+		Caption:  "Отчет за " + report.title(),
+	}); err != nil {
+		log.Printf("can't send document to %v, error: %v", chatID, err)
+	}
+}
+
+// reportCommand обрабатывает /report с месяцем или без него: тогда месяц выбирается кнопками
+func reportCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	loc := getUserLocation(chatID)
+	_, args, _ := strings.Cut(strings.TrimSpace(update.Message.Text), " ")
+	if args = strings.TrimSpace(args); args != "" {
+		month, err := parseReportMonth(args, loc)
+		if err != nil {
+			if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   err.Error(),
+			}); err != nil {
+				log.Println("error sending msg ", chatID, err)
+			}
+			return
+		}
+
+		sendMonthlyReport(ctx, b, chatID, month)
+		return
+	}
+
+	now := time.Now().In(loc)
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+
+	var keyboard [][]models.InlineKeyboardButton
+	var row []models.InlineKeyboardButton
+	for i := 0; i < pdfReportMonths; i++ {
+		month := current.AddDate(0, -i, 0)
+		row = append(row, models.InlineKeyboardButton{
+			Text:         calendarMonths[month.Month()-1] + " " + fmt.Sprint(month.Year()),
+			CallbackData: pdfReportCallbackPrefix + month.Format(calendarMonthLayout),
+		})
+		if len(row) == 2 {
+			keyboard = append(keyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "За какой месяц собрать PDF-отчет? Другой месяц можно указать командой, например: /report 04-2024",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func pdfReportCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	args := strings.TrimPrefix(update.CallbackQuery.Data, pdfReportCallbackPrefix)
+	month, err := time.ParseInLocation(calendarMonthLayout, args, getUserLocation(chatID))
+	if err != nil {
+		log.Println("invalid report month ", args)
+		return
+	}
+
+	sendMonthlyReport(ctx, b, chatID, month)
+}
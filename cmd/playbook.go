@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных плейбука и выбора стратегии при добавлении сделки
+const playbookCallbackPrefix = "/playbook:"
+
+const maxStrategyRules = 10
+
+// Мапа стратегий, которые пользователь сейчас добавляет в плейбук
+var usersPendingStrategy = make(map[int64]*Strategy)
+
+func playbookCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	strategies, err := Repository.getStrategies(chatID)
+	if err != nil {
+		log.Println("Error getting strategies: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка получения плейбука",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	text := "<b>Ваш плейбук 📖</b>\n\n"
+	if len(strategies) == 0 {
+		text += "Пока нет ни одной стратегии. Добавьте первую, чтобы отмечать соблюдение правил в сделках."
+	}
+
+	for _, strategy := range strategies {
+		rules, err := Repository.getStrategyRules(strategy.ID)
+		if err != nil {
+			log.Println("Error getting strategy rules: ", err)
+			return
+		}
+
+		text += "<b>" + html.EscapeString(strategy.Name) + "</b>\n"
+		if strategy.Description != "" {
+			text += html.EscapeString(strategy.Description) + "\n"
+		}
+		for i, rule := range rules {
+			text += strconv.Itoa(i+1) + ". " + html.EscapeString(rule.Text) + "\n"
+		}
+		text += "\n"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Добавить стратегию", CallbackData: playbookCallbackPrefix + "add"}},
+		}},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func handleStrategyName(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	name := strings.TrimSpace(update.Message.Text)
+	if err := validateStrategyName(name); err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	strategies, err := Repository.getStrategies(chatID)
+	if err != nil {
+		log.Println("Error getting strategies: ", err)
+		return
+	}
+	for _, strategy := range strategies {
+		if strings.EqualFold(strategy.Name, name) {
+			if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "Стратегия с таким названием уже есть, введите другое название:",
+			}); err != nil {
+				log.Println("error sending msg ", chatID, err)
+			}
+			return
+		}
+	}
+
+	usersPendingStrategy[chatID] = &Strategy{Name: name}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Опишите стратегию: рынок, таймфрейм, идея входа.",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingStrategyDescription
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingStrategyDescription)
+}
+
+func handleStrategyDescription(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	strategy := usersPendingStrategy[chatID]
+	if strategy == nil {
+		usersStates[chatID] = StateIdle
+		return
+	}
+
+	if err := validateNote(update.Message.Text); err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	strategy.Description = strings.TrimSpace(update.Message.Text)
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Перечислите правила входа, каждое с новой строки:",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingStrategyRules
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingStrategyRules)
+}
+
+func handleStrategyRules(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	strategy := usersPendingStrategy[chatID]
+	if strategy == nil {
+		usersStates[chatID] = StateIdle
+		return
+	}
+
+	rules, err := parseStrategyRules(update.Message.Text)
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	strategy.Rules = rules
+
+	if err := Repository.createStrategy(chatID, strategy); err != nil {
+		log.Println("Error saving strategy: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка сохранения стратегии",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	delete(usersPendingStrategy, chatID)
+	usersStates[chatID] = StateIdle
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Стратегия " + strategy.Name + " добавлена в плейбук ✅",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	if err := showStandardButtons(ctx, b, update); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+// askDealStrategy предлагает выбрать стратегию для новой сделки.
+// Если в плейбуке нет стратегий, сразу переходим к вводу количества.
+func askDealStrategy(ctx context.Context, b *bot.Bot, chatID int64) {
+	strategies, err := Repository.getStrategies(chatID)
+	if err != nil {
+		log.Println("Error getting strategies: ", err)
+	}
+
+	if len(strategies) == 0 {
+		askDealAmount(ctx, b, chatID)
+		return
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, strategy := range strategies {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: strategy.Name, CallbackData: playbookCallbackPrefix + "pick:" + strconv.FormatInt(strategy.ID, 10)}})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Без стратегии", CallbackData: playbookCallbackPrefix + "pick:0"}})
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "По какой стратегии сделка?",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateIdle
+}
+
+func buildRuleChecklist(strategy *Strategy, checks map[int64]bool) *models.InlineKeyboardMarkup {
+	var keyboard [][]models.InlineKeyboardButton
+	for _, rule := range strategy.Rules {
+		mark := "⬜ "
+		if checks[rule.ID] {
+			mark = "✅ "
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: mark + rule.Text, CallbackData: playbookCallbackPrefix + "rule:" + strconv.FormatInt(rule.ID, 10)}})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Готово", CallbackData: playbookCallbackPrefix + "rules_done"}})
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+func playbookCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, playbookCallbackPrefix), ":")
+
+	if action == "add" {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Введите название стратегии (напр. Пробой уровня):",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+			return
+		}
+
+		usersStates[chatID] = StateAwaitingStrategyName
+		log.Printf("update user %v state for %v  ", chatID, StateAwaitingStrategyName)
+		return
+	}
+
+	deal := usersPendingDeal[chatID]
+	if deal == nil {
+		return
+	}
+
+	switch action {
+	case "pick":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid strategy id ", args)
+			return
+		}
+
+		if id == 0 {
+			askDealAmount(ctx, b, chatID)
+			return
+		}
+
+		strategy, err := Repository.getStrategy(chatID, id)
+		if err != nil || strategy == nil {
+			log.Println("Error getting strategy: ", err)
+			return
+		}
+		deal.StrategyID = strategy.ID
+		deal.Strategy = strategy.Name
+
+		if len(strategy.Rules) == 0 {
+			askDealAmount(ctx, b, chatID)
+			return
+		}
+
+		deal.RuleChecks = make(map[int64]bool, len(strategy.Rules))
+		for _, rule := range strategy.Rules {
+			deal.RuleChecks[rule.ID] = false
+		}
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        "Отметьте правила, которые соблюдены в этой сделке:",
+			ReplyMarkup: buildRuleChecklist(strategy, deal.RuleChecks),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+	case "rule":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid rule id ", args)
+			return
+		}
+
+		if _, ok := deal.RuleChecks[id]; !ok || update.CallbackQuery.Message.Message == nil {
+			return
+		}
+		deal.RuleChecks[id] = !deal.RuleChecks[id]
+
+		strategy, err := Repository.getStrategy(chatID, deal.StrategyID)
+		if err != nil || strategy == nil {
+			log.Println("Error getting strategy: ", err)
+			return
+		}
+
+		if _, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+			ChatID:      chatID,
+			MessageID:   update.CallbackQuery.Message.Message.ID,
+			ReplyMarkup: buildRuleChecklist(strategy, deal.RuleChecks),
+		}); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	case "rules_done":
+		askDealAmount(ctx, b, chatID)
+	}
+}
+
+func parseStrategyRules(text string) ([]*StrategyRule, error) {
+	var rules []*StrategyRule
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if utf8.RuneCountInString(line) > 60 {
+			return nil, fmt.Errorf("слишком длинное правило: %s", line)
+		}
+		rules = append(rules, &StrategyRule{Text: line})
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("empty rules")
+	}
+
+	if len(rules) > maxStrategyRules {
+		return nil, fmt.Errorf("слишком много правил, максимум %d", maxStrategyRules)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных /portfolio
+const portfolioCallbackPrefix = "/portfolio:"
+
+// Валюты котировки, которые узнаются в конце пары без разделителя, например BTCUSDT
+var knownQuoteCurrencies = []string{"USDT", "USDC", "BUSD", "USD", "EUR", "RUB", "BTC", "ETH"}
+
+// quoteCurrency определяет валюту котировки пары: BTC/USD, BTC-USD, BTCUSDT -> USD, USD, USDT
+func quoteCurrency(pair string) string {
+	pair = normalizePair(pair)
+	if i := strings.LastIndexAny(pair, "/-"); i >= 0 && i < len(pair)-1 {
+		return pair[i+1:]
+	}
+
+	for _, currency := range knownQuoteCurrencies {
+		if len(pair) > len(currency) && strings.HasSuffix(pair, currency) {
+			return currency
+		}
+	}
+
+	return "?"
+}
+
+// portfolioExposure - вложения в одной валюте котировки
+type portfolioExposure struct {
+	Value      decimal.Decimal // стоимость позиций по текущей цене, без цены - по цене покупки
+	Unrealized decimal.Decimal
+	Positions  int
+}
+
+// buildPortfolioText описывает открытые позиции с нереализованным P&L по ценам prices
+func buildPortfolioText(positions []*Deal, prices map[string]decimal.Decimal, account *Account, now time.Time, loc *time.Location) string {
+	var sb strings.Builder
+	sb.WriteString("<b>Портфель 💼</b> (" + html.EscapeString(accountLabel(account)) + ")\n\n")
+
+	exposures := make(map[string]*portfolioExposure)
+	for i, position := range positions {
+		currency := quoteCurrency(position.Pair)
+		exposure := exposures[currency]
+		if exposure == nil {
+			exposure = &portfolioExposure{}
+			exposures[currency] = exposure
+		}
+		exposure.Positions++
+
+		sb.WriteString(fmt.Sprintf("%d. <b>%s</b>\nКоличество: %s\nПокупка: %s\n", i+1, html.EscapeString(position.Pair), position.Amount.String(), position.BuyPrice.String()))
+
+		price, ok := prices[normalizePair(position.Pair)]
+		if !ok {
+			exposure.Value = exposure.Value.Add(position.BuyPrice.Mul(position.Amount))
+			sb.WriteString("Текущая цена: нет данных\n\n")
+			continue
+		}
+
+		// Считаем как если бы позицию закрыли по текущей цене
+		unrealized := *position
+		unrealized.SellPrice = price
+		calculateProfit(&unrealized)
+
+		exposure.Value = exposure.Value.Add(price.Mul(position.Amount))
+		exposure.Unrealized = exposure.Unrealized.Add(unrealized.Profit)
+
+		sb.WriteString(fmt.Sprintf("Текущая цена: %s\nP&L: %s %s (%s%%)\n\n", price.String(), unrealized.Profit.String(), html.EscapeString(currency), unrealized.ProfitPercent.Truncate(2).String()))
+	}
+
+	currencies := make([]string, 0, len(exposures))
+	for currency := range exposures {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	sb.WriteString("<b>Вложения по валютам:</b>\n")
+	for _, currency := range currencies {
+		exposure := exposures[currency]
+		sb.WriteString(fmt.Sprintf("%s: %s, P&L %s (позиций: %d)\n", html.EscapeString(currency), exposure.Value.Truncate(2).String(), exposure.Unrealized.Truncate(2).String(), exposure.Positions))
+	}
+
+	if Prices == nil {
+		sb.WriteString("\nИсточник цен не настроен, P&L недоступен")
+	}
+	sb.WriteString("\nОбновлено: " + now.In(loc).Format(dateTimeLayout+":05"))
+
+	return sb.String()
+}
+
+// showPortfolio отправляет портфель новым сообщением или, если передан messageID,
+// обновляет цены в уже показанном сообщении
+func showPortfolio(ctx context.Context, b *bot.Bot, chatID int64, messageID int) error {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		return err
+	}
+
+	positions, err := Repository.getOpenPositions(chatID)
+	if err != nil {
+		return err
+	}
+	if account != nil {
+		positions = filterAccountDeals(positions, account.ID)
+	}
+
+	text := "Открытых позиций нет"
+	var keyboard *models.InlineKeyboardMarkup
+	if len(positions) > 0 {
+		prices := make(map[string]decimal.Decimal)
+		if Prices != nil {
+			pairs := make([]string, 0, len(positions))
+			for _, position := range positions {
+				pairs = append(pairs, normalizePair(position.Pair))
+			}
+
+			// Без цен портфель все равно показываем, просто без P&L
+			if prices, err = Prices.Prices(ctx, pairs); err != nil {
+				log.Println("Error getting prices: ", err)
+			}
+		}
+
+		text = buildPortfolioText(positions, prices, account, time.Now(), getUserLocation(chatID))
+		keyboard = &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: "🔄 Обновить", CallbackData: portfolioCallbackPrefix + "refresh"},
+		}}}
+	}
+
+	if messageID == 0 {
+		params := &bot.SendMessageParams{
+			ChatID:    chatID,
+			Text:      text,
+			ParseMode: models.ParseModeHTML,
+		}
+		if keyboard != nil {
+			params.ReplyMarkup = keyboard
+		}
+		_, err = b.SendMessage(ctx, params)
+		return err
+	}
+
+	params := &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	_, err = b.EditMessageText(ctx, params)
+	return err
+}
+
+func portfolioCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	if err := showPortfolio(ctx, b, chatID, 0); err != nil {
+		log.Printf("can't send portfolio to %v, error: %v", chatID, err)
+	}
+}
+
+func portfolioCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, _, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, portfolioCallbackPrefix), ":")
+
+	switch action {
+	case "refresh":
+		if err := showPortfolio(ctx, b, chatID, getMessageID(update)); err != nil {
+			log.Printf("can't edit message for %v, error: %v", chatID, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных открытых позиций
+const positionCallbackPrefix = "/position:"
+
+func positionsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	positions, err := Repository.getOpenPositions(chatID)
+	if err != nil {
+		log.Println("Error getting open positions: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка получения открытых позиций",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	if len(positions) == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Открытых позиций нет",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	loc := getUserLocation(chatID)
+
+	var sb strings.Builder
+	var keyboard [][]models.InlineKeyboardButton
+	sb.WriteString("<b>Открытые позиции</b>\n\n")
+	for i, position := range positions {
+		sb.WriteString(fmt.Sprintf("%d. <b>%s</b>\nКоличество: %s\nПокупка: %s$\n", i+1, html.EscapeString(position.Pair), position.Amount.String(), position.BuyPrice.String()))
+		sb.WriteString(formatRisk(position))
+		sb.WriteString("Открыта: " + formatDateTime(position.Date, loc) + "\n\n")
+
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("Закрыть %d. %s", i+1, position.Pair),
+			CallbackData: positionCallbackPrefix + "close:" + strconv.FormatInt(position.ID, 10),
+		}})
+	}
+
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "💼 Текущий P&L", CallbackData: "/portfolio"}})
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        sb.String(),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func positionCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, positionCallbackPrefix), ":")
+
+	switch action {
+	case "keep_open":
+		deal := usersPendingDeal[chatID]
+		if deal == nil || deal.ID != 0 || usersStates[chatID] != StateAwaitingSellPrice {
+			return
+		}
+		openPosition(ctx, b, update, deal)
+	case "close":
+		dealID, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			log.Println("invalid deal id ", args)
+			return
+		}
+
+		deal, err := Repository.getDeal(chatID, dealID)
+		if err != nil || deal == nil {
+			log.Println("Error getting deal: ", err)
+			return
+		}
+
+		if !deal.Open {
+			if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "Эта позиция уже закрыта",
+			}); err != nil {
+				log.Println("error sending msg ", chatID, err)
+			}
+			return
+		}
+
+		// Дата выхода будет выбрана при закрытии
+		deal.Date = time.Time{}
+		usersPendingDeal[chatID] = deal
+		askSellPrice(ctx, b, chatID)
+	}
+}
+
+// openPosition сохраняет сделку без цены продажи, ее можно будет закрыть из /positions
+func openPosition(ctx context.Context, b *bot.Bot, update *models.Update, deal *Deal) {
+	chatID := getChatID(update)
+
+	deal.Open = true
+	// У открытой позиции дата сделки совпадает с датой входа
+	if deal.EntryDate.IsZero() {
+		deal.EntryDate = time.Now().UTC()
+	}
+	deal.Date = deal.EntryDate
+
+	if err := Repository.saveDeal(deal, chatID); err != nil {
+		log.Println("Error saving deal: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Ошибка сохранения позиции",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	usersPendingDeal[chatID] = nil
+	usersStates[chatID] = StateIdle
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      "<b>Позиция открыта 📈</b>\n<b>Пара:</b> " + html.EscapeString(deal.Pair) + "\n<b>Количество:</b> " + deal.Amount.String() + "\n<b>Покупка:</b> " + deal.BuyPrice.String() + "\nЗакрыть ее можно в разделе /positions",
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+
+	if err := showStandardButtons(ctx, b, update); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Таймаут запроса к HTTP-источнику цен
+const priceRequestTimeout = 10 * time.Second
+
+// PriceSource отдает текущие цены пар. Пары, для которых цены нет, в ответ не попадают
+type PriceSource interface {
+	Prices(ctx context.Context, pairs []string) (map[string]decimal.Decimal, error)
+}
+
+// Prices - источник цен бота, nil если источник не настроен
+var Prices PriceSource
+
+// newPriceSource создает источник цен по адресу из настроек:
+// http(s)-адрес опрашивается по сети, иначе цены читаются из локального файла
+func newPriceSource(location string) PriceSource {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return &httpPriceSource{url: location, client: &http.Client{Timeout: priceRequestTimeout}}
+	}
+
+	return &filePriceSource{path: location}
+}
+
+// normalizePair приводит название пары к виду, в котором она хранится в источнике цен: BTC/USD
+func normalizePair(pair string) string {
+	return strings.ToUpper(strings.TrimSpace(pair))
+}
+
+// parsePriceSnapshot разбирает JSON вида {"BTC/USD": "70000.5", "ETH/USD": 3500}
+// и оставляет только запрошенные пары
+func parsePriceSnapshot(r io.Reader, pairs []string) (map[string]decimal.Decimal, error) {
+	var snapshot map[string]decimal.Decimal
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("invalid price snapshot: %w", err)
+	}
+
+	known := make(map[string]decimal.Decimal, len(snapshot))
+	for pair, price := range snapshot {
+		known[normalizePair(pair)] = price
+	}
+
+	prices := make(map[string]decimal.Decimal, len(pairs))
+	for _, pair := range pairs {
+		if price, ok := known[normalizePair(pair)]; ok {
+			prices[pair] = price
+		}
+	}
+
+	return prices, nil
+}
+
+// filePriceSource читает цены из JSON-файла при каждом запросе, поэтому файл можно
+// обновлять на ходу. Подходит для работы без сети и для проверки уведомлений вручную
+type filePriceSource struct {
+	path string
+}
+
+func (s *filePriceSource) Prices(_ context.Context, pairs []string) (map[string]decimal.Decimal, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parsePriceSnapshot(f, pairs)
+}
+
+// httpPriceSource запрашивает тот же JSON по HTTP, например у собственного прокси к бирже
+type httpPriceSource struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpPriceSource) Prices(ctx context.Context, pairs []string) (map[string]decimal.Decimal, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price source responded with %s", resp.Status)
+	}
+
+	return parsePriceSnapshot(resp.Body, pairs)
+}
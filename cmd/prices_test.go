@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParsePriceSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		pairs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "string and number prices",
+			json:  `{"BTC/USD": "70000.5", "ETH/USD": 3500}`,
+			pairs: []string{"BTC/USD", "ETH/USD"},
+			want:  map[string]string{"BTC/USD": "70000.5", "ETH/USD": "3500"},
+		},
+		{
+			name:  "case is normalised, requested key is kept",
+			json:  `{"btc/usd": "70000", " ETH/USD ": "3500"}`,
+			pairs: []string{"BTC/USD", "eth/usd"},
+			want:  map[string]string{"BTC/USD": "70000", "eth/usd": "3500"},
+		},
+		{
+			name:  "missing pairs are skipped",
+			json:  `{"BTC/USD": "70000"}`,
+			pairs: []string{"BTC/USD", "SOL/USD"},
+			want:  map[string]string{"BTC/USD": "70000"},
+		},
+		{
+			name:  "no pairs requested",
+			json:  `{"BTC/USD": "70000"}`,
+			pairs: nil,
+			want:  map[string]string{},
+		},
+		{name: "not json", json: `BTC/USD=70000`, pairs: []string{"BTC/USD"}, wantErr: true},
+		{name: "bad price", json: `{"BTC/USD": "дорого"}`, pairs: []string{"BTC/USD"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePriceSnapshot(strings.NewReader(tt.json), tt.pairs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePriceSnapshot() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePriceSnapshot() error: %v", err)
+			}
+			assertPrices(t, got, tt.want)
+		})
+	}
+}
+
+func TestFilePriceSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	source := &filePriceSource{path: path}
+
+	if _, err := source.Prices(context.Background(), []string{"BTC/USD"}); err == nil {
+		t.Fatal("Prices() without file: want error")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"BTC/USD": "70000", "ETH/USD": "3500"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := source.Prices(context.Background(), []string{"BTC/USD", "SOL/USD"})
+	if err != nil {
+		t.Fatalf("Prices() error: %v", err)
+	}
+	assertPrices(t, got, map[string]string{"BTC/USD": "70000"})
+
+	// Файл перечитывается при каждом запросе
+	if err := os.WriteFile(path, []byte(`{"BTC/USD": "71000"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = source.Prices(context.Background(), []string{"BTC/USD"})
+	if err != nil {
+		t.Fatalf("Prices() error: %v", err)
+	}
+	assertPrices(t, got, map[string]string{"BTC/USD": "71000"})
+}
+
+func assertPrices(t *testing.T, got map[string]decimal.Decimal, want map[string]string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("prices = %v, want %v", got, want)
+	}
+	for pair, price := range want {
+		if !got[pair].Equal(decimal.RequireFromString(price)) {
+			t.Errorf("prices[%q] = %v, want %v", pair, got[pair], price)
+		}
+	}
+}
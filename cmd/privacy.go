@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const deleteMeCallbackPrefix = "/delete_me:"
+
+// Кнопка окончательного подтверждения удаления действует ограниченное время
+const deleteConfirmTTL = 10 * time.Minute
+
+// userDataSummary - сколько записей каждого вида хранится о пользователе
+type userDataSummary struct {
+	Pairs         int
+	ClosedDeals   int
+	OpenPositions int
+	Journals      int
+	Attachments   int
+	RuleChecks    int
+	LevelHits     int
+	Tags          int
+	Strategies    int
+	Rules         int
+	Accounts      int
+	CashFlows     int
+	Breaches      int
+	Reports       int
+	Alerts        int
+}
+
+func (s *userDataSummary) lines() []string {
+	return []string{
+		fmt.Sprintf("Пары: %d", s.Pairs),
+		fmt.Sprintf("Закрытые сделки: %d", s.ClosedDeals),
+		fmt.Sprintf("Открытые позиции: %d", s.OpenPositions),
+		fmt.Sprintf("Сделки с записями журнала: %d", s.Journals),
+		fmt.Sprintf("Скриншоты и файлы сделок: %d", s.Attachments),
+		fmt.Sprintf("Отметки о соблюдении правил: %d", s.RuleChecks),
+		fmt.Sprintf("Срабатывания стопов и тейков: %d", s.LevelHits),
+		fmt.Sprintf("Теги: %d", s.Tags),
+		fmt.Sprintf("Стратегии: %d, правил в них: %d", s.Strategies, s.Rules),
+		fmt.Sprintf("Счета: %d, пополнений и выводов: %d", s.Accounts, s.CashFlows),
+		fmt.Sprintf("Нарушения лимитов: %d", s.Breaches),
+		fmt.Sprintf("Отчеты по расписанию: %d", s.Reports),
+		fmt.Sprintf("Уведомления о цене: %d", s.Alerts),
+	}
+}
+
+func buildMyDataText(user *User, account *Account, s *userDataSummary) string {
+	var sb strings.Builder
+	sb.WriteString("<b>Что бот хранит о вас 🗂</b>\n\n")
+
+	sb.WriteString("<b>Профиль</b>\n")
+	sb.WriteString("Имя в Telegram: " + html.EscapeString(user.Name) + "\n")
+	sb.WriteString("ID чата: " + strconv.FormatInt(user.ChatID, 10) + "\n")
+	sb.WriteString("Часовой пояс: " + html.EscapeString(user.Timezone) + "\n")
+	sb.WriteString("Текущий портфель: " + html.EscapeString(accountLabel(account)) + "\n")
+	sb.WriteString(fmt.Sprintf("Сделок на странице истории: %d\n", user.HistoryPageSize))
+	if !user.Balance.IsZero() {
+		sb.WriteString("Баланс из калькулятора /size: " + user.Balance.String() + "\n")
+	}
+	if !user.Limits.MaxDailyLoss.IsZero() || user.Limits.MaxDailyTrades > 0 || user.Limits.MaxConsecutiveLosses > 0 {
+		sb.WriteString("Дневные лимиты торговли: заданы\n")
+	}
+
+	sb.WriteString("\n<b>Журнал</b>\n")
+	sb.WriteString(strings.Join(s.lines(), "\n"))
+
+	sb.WriteString("\n\nСкриншоты хранятся в Telegram, бот хранит только ссылки на них.\n" +
+		"/backup - скачать все данные одним файлом\n/delete_me - удалить все данные")
+
+	return sb.String()
+}
+
+func myDataCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		log.Println("Error getting user: ", err)
+		return
+	}
+
+	account, err := currentAccount(chatID)
+	if err != nil {
+		log.Println("Error getting current account: ", err)
+		return
+	}
+
+	summary, err := Repository.getUserDataSummary(chatID)
+	if err != nil {
+		log.Println("Error getting user data summary: ", err)
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      buildMyDataText(user, account, summary),
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func deleteMeCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	summary, err := Repository.getUserDataSummary(chatID)
+	if err != nil {
+		log.Println("Error getting user data summary: ", err)
+		return
+	}
+
+	text := "<b>Удаление всех ваших данных</b>\n\nБудут удалены профиль, настройки и весь журнал:\n" +
+		strings.Join(summary.lines(), "\n") +
+		"\n\nВосстановить их после удаления нельзя. Можно сначала получить резервную копию: из нее журнал восстанавливается командой /restore"
+
+	kb := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{{Text: "Скачать копию и удалить", CallbackData: deleteMeCallbackPrefix + "ask:1"}},
+		{{Text: "Удалить без копии", CallbackData: deleteMeCallbackPrefix + "ask:0"}},
+		{{Text: "Отмена", CallbackData: deleteMeCallbackPrefix + "cancel"}},
+	}}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+// forgetUser сбрасывает незавершенные действия пользователя, хранящиеся в памяти
+func forgetUser(chatID int64) {
+	delete(usersStates, chatID)
+	delete(usersPendingDeal, chatID)
+	delete(usersPendingJournal, chatID)
+	delete(usersPendingStrategy, chatID)
+	delete(usersPendingAccount, chatID)
+	delete(usersPendingCashFlow, chatID)
+	delete(usersPendingLimit, chatID)
+	delete(usersPendingSize, chatID)
+	delete(usersPendingRestore, chatID)
+	delete(usersHistoryFilter, chatID)
+	delete(usersAttachDeal, chatID)
+}
+
+// deleteUserData удаляет все данные пользователя, при export сначала отправляет резервную копию
+func deleteUserData(ctx context.Context, b *bot.Bot, chatID int64, export bool) string {
+	if export {
+		if err := sendBackup(ctx, b, chatID); err != nil {
+			log.Println("Error sending backup: ", err)
+			return "Не удалось подготовить резервную копию, данные не удалены"
+		}
+	}
+
+	if err := Repository.deleteUser(chatID); err != nil {
+		log.Println("Error deleting user: ", err)
+		return "Не удалось удалить данные, попробуйте позже"
+	}
+	forgetUser(chatID)
+	log.Println("Deleted user data: ", chatID)
+
+	return "Все ваши данные удалены 🗑\nЕсли снова напишете боту, для вас будет создан новый пустой профиль"
+}
+
+func deleteMeCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, deleteMeCallbackPrefix), ":")
+
+	params := &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: getMessageID(update),
+	}
+
+	switch action {
+	case "cancel":
+		params.Text = "Удаление отменено, данные на месте"
+	case "ask":
+		export := args == "1"
+		params.Text = "Точно удалить все данные? Это действие нельзя отменить"
+		if export {
+			params.Text += "\nПеред удалением бот пришлет резервную копию"
+		}
+		params.ReplyMarkup = models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Да, удалить навсегда", CallbackData: fmt.Sprintf("%syes:%s:%d", deleteMeCallbackPrefix, args, time.Now().Unix())}},
+			{{Text: "Отмена", CallbackData: deleteMeCallbackPrefix + "cancel"}},
+		}}
+	case "yes":
+		flag, issued, _ := strings.Cut(args, ":")
+		unix, err := strconv.ParseInt(issued, 10, 64)
+		if err != nil {
+			log.Println("invalid delete confirmation ", args)
+			return
+		}
+
+		if time.Since(time.Unix(unix, 0)) > deleteConfirmTTL {
+			params.Text = "Подтверждение устарело, отправьте /delete_me еще раз"
+			break
+		}
+		params.Text = deleteUserData(ctx, b, chatID, flag == "1")
+	default:
+		return
+	}
+
+	// Сообщение с кнопками может быть уже недоступно, тогда ответ приходит новым сообщением
+	if params.MessageID == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        params.Text,
+			ReplyMarkup: params.ReplyMarkup,
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.EditMessageText(ctx, params); err != nil {
+		log.Println("error editing msg ", chatID, err)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Префикс callback-данных расписания отчетов
+const reportsCallbackPrefix = "/reports:"
+
+// Час отправки отчетов по умолчанию
+const defaultReportHour = 9
+
+var reportPeriods = []ReportPeriod{ReportDaily, ReportWeekly, ReportMonthly}
+
+var reportNames = map[ReportPeriod]string{
+	ReportDaily:   "Ежедневный отчет",
+	ReportWeekly:  "Еженедельный отчет",
+	ReportMonthly: "Ежемесячный отчет",
+}
+
+// buildPeriodSummary собирает итоги сделок, закрытых в интервале [from, to)
+func buildPeriodSummary(userID int64, period ReportPeriod, from, to time.Time, loc *time.Location) (string, error) {
+	deals, err := Repository.getDeals(userID)
+	if err != nil {
+		return "", err
+	}
+
+	var total dealGroupStats
+	var best, worst *Deal
+	for _, deal := range deals {
+		if deal.Date.Before(from) || !deal.Date.Before(to) {
+			continue
+		}
+
+		total.add(deal)
+		if best == nil || deal.Profit.GreaterThan(best.Profit) {
+			best = deal
+		}
+		if worst == nil || deal.Profit.LessThan(worst.Profit) {
+			worst = deal
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>" + reportNames[period] + " 🗓</b>\n")
+	sb.WriteString(formatDateTime(from, loc) + " — " + formatDateTime(to, loc) + "\n\n")
+
+	if total.Count == 0 {
+		sb.WriteString("За период сделок не было")
+		return sb.String(), nil
+	}
+
+	sb.WriteString("<b>Итого:</b> " + total.String() + "\n")
+	sb.WriteString("<b>Лучшая сделка:</b> " + html.EscapeString(best.Pair) + " " + best.Profit.String() + "$ (" + best.ProfitPercent.Truncate(2).String() + "%)\n")
+	sb.WriteString("<b>Худшая сделка:</b> " + html.EscapeString(worst.Pair) + " " + worst.Profit.String() + "$ (" + worst.ProfitPercent.Truncate(2).String() + "%)\n")
+
+	return sb.String(), nil
+}
+
+func reportsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	showReports(ctx, b, chatID)
+}
+
+func showReports(ctx context.Context, b *bot.Bot, chatID int64) {
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		log.Println("Error getting user: ", err)
+		return
+	}
+
+	schedules, err := Repository.getReportSchedules(chatID)
+	if err != nil {
+		log.Println("Error getting report schedules: ", err)
+		return
+	}
+
+	enabled := make(map[ReportPeriod]*ReportSchedule)
+	for _, schedule := range schedules {
+		enabled[schedule.Period] = schedule
+	}
+
+	loc := userLocation(user.Timezone)
+
+	text := "<b>Автоматические отчеты 🗓</b>\n" +
+		"Часовой пояс: " + html.EscapeString(loc.String()) + "\n" +
+		"Время отправки: " + strconv.Itoa(reportHour(schedules)) + ":00\n\n"
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, period := range reportPeriods {
+		mark := "⬜ "
+		if schedule := enabled[period]; schedule != nil {
+			mark = "✅ "
+			text += reportNames[period] + ": следующий " + formatDateTime(schedule.NextRun, loc) + "\n"
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: mark + reportNames[period], CallbackData: reportsCallbackPrefix + "toggle:" + string(period)}})
+	}
+	if len(schedules) == 0 {
+		text += "Отчеты выключены"
+	}
+
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: "Время отправки", CallbackData: reportsCallbackPrefix + "hour"},
+		{Text: "Часовой пояс", CallbackData: reportsCallbackPrefix + "timezone"},
+	})
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+// reportHour - час отправки отчетов пользователя, у всех его расписаний он общий
+func reportHour(schedules []*ReportSchedule) int {
+	if len(schedules) == 0 {
+		return defaultReportHour
+	}
+
+	return schedules[0].Hour
+}
+
+// rescheduleReports пересчитывает время отправки всех отчетов после смены часа или часового пояса
+func rescheduleReports(chatID int64, hour int, timezone string) error {
+	schedules, err := Repository.getReportSchedules(chatID)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		schedule.Hour = hour
+		schedule.NextRun = nextReportRun(schedule.Period, hour, userLocation(timezone), time.Now())
+		if err := Repository.saveReportSchedule(schedule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reportsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(update.CallbackQuery.Data, reportsCallbackPrefix), ":")
+
+	switch action {
+	case "toggle":
+		period := ReportPeriod(args)
+		if reportNames[period] == "" {
+			return
+		}
+
+		user, err := Repository.getUser(chatID)
+		if err != nil || user == nil {
+			log.Println("Error getting user: ", err)
+			return
+		}
+
+		schedules, err := Repository.getReportSchedules(chatID)
+		if err != nil {
+			log.Println("Error getting report schedules: ", err)
+			return
+		}
+
+		enabled := false
+		for _, schedule := range schedules {
+			enabled = enabled || schedule.Period == period
+		}
+
+		if enabled {
+			err = Repository.deleteReportSchedule(chatID, period)
+		} else {
+			hour := reportHour(schedules)
+			err = Repository.saveReportSchedule(&ReportSchedule{
+				UserID:  chatID,
+				Period:  period,
+				Hour:    hour,
+				NextRun: nextReportRun(period, hour, userLocation(user.Timezone), time.Now()),
+			})
+		}
+		if err != nil {
+			log.Println("Error saving report schedule: ", err)
+			return
+		}
+
+		showReports(ctx, b, chatID)
+	case "hour":
+		sendReportsPrompt(ctx, b, chatID, "Введите час отправки отчетов от 0 до 23:", StateAwaitingReportHour)
+	case "timezone":
+		askTimezone(ctx, b, chatID)
+	}
+}
+
+func sendReportsPrompt(ctx context.Context, b *bot.Bot, chatID int64, text string, state UserState) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = state
+	log.Printf("update user %v state for %v  ", chatID, state)
+}
+
+func sendReportsError(ctx context.Context, b *bot.Bot, chatID int64, err error) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   err.Error(),
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func handleReportHour(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	hour, err := strconv.Atoi(strings.TrimSpace(update.Message.Text))
+	if err != nil || hour < 0 || hour > 23 {
+		sendReportsError(ctx, b, chatID, fmt.Errorf("час должен быть числом от 0 до 23"))
+		return
+	}
+
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		log.Println("Error getting user: ", err)
+		return
+	}
+
+	// Час хранится в расписаниях, без них его негде сохранить
+	schedules, err := Repository.getReportSchedules(chatID)
+	if err != nil {
+		log.Println("Error getting report schedules: ", err)
+		return
+	}
+	if len(schedules) == 0 {
+		usersStates[chatID] = StateIdle
+		sendReportsError(ctx, b, chatID, fmt.Errorf("сначала включите хотя бы один отчет"))
+		return
+	}
+
+	if err := rescheduleReports(chatID, hour, user.Timezone); err != nil {
+		log.Println("Error saving report schedule: ", err)
+		return
+	}
+
+	usersStates[chatID] = StateIdle
+	showReports(ctx, b, chatID)
+}
@@ -3,11 +3,46 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
+// selectDealsQuery выбирает сделки вместе с данными журнала, числом скриншотов и тегами, порядок колонок соответствует scanDeals
+const selectDealsQuery = `
+        SELECT d.deal_id, p.pair_name, d.buy_price, COALESCE(d.sell_price, 0), COALESCE(d.profit, 0), COALESCE(d.profit_percent, 0), d.deal_date,
+               d.sell_price IS NULL,
+               COALESCE(d.note, ''), COALESCE(d.strategy_id, 0), COALESCE(s.name, ''), COALESCE(d.execution_rating, 0), COALESCE(d.emotion, ''),
+               (SELECT COUNT(*) FROM DealAttachments AS a WHERE a.deal_id = d.deal_id),
+               COALESCE((SELECT string_agg(t.name, ' ' ORDER BY t.name) FROM DealTags AS dt JOIN Tags AS t ON dt.tag_id = t.tag_id WHERE dt.deal_id = d.deal_id), ''),
+               COALESCE(d.amount, 0), COALESCE(d.stop_loss, 0), COALESCE(d.take_profit, 0),
+               COALESCE(d.account_id, 0), d.entry_date
+        FROM Deals AS d
+        JOIN Pairs AS p ON d.pair_id = p.pair_id
+        LEFT JOIN Strategies AS s ON d.strategy_id = s.strategy_id`
+
+// where возвращает дополнительные условия фильтра для запроса по Deals AS d.
+// Параметры фильтра дописываются в конец args и нумеруются после уже переданных.
+func (f dealFilter) where(args []any) (string, []any) {
+	var conditions string
+
+	if f.TagID != 0 {
+		args = append(args, f.TagID)
+		conditions += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM DealTags AS dt WHERE dt.deal_id = d.deal_id AND dt.tag_id = $%d)", len(args))
+	}
+
+	if f.AccountID != 0 {
+		args = append(args, f.AccountID)
+		conditions += fmt.Sprintf(" AND d.account_id = $%d", len(args))
+	}
+
+	return conditions, args
+}
+
 type repository struct {
 	conn *sql.DB
 }
@@ -41,13 +76,17 @@ func (r *repository) saveUser(u *User) error {
 
 func (r *repository) getUser(id int64) (*User, error) {
 	query := `
-		SELECT username, chat_id
+		SELECT username, chat_id, history_page_size, COALESCE(balance, 0), COALESCE(current_account_id, 0),
+		       COALESCE(max_daily_loss, 0), COALESCE(max_daily_trades, 0), COALESCE(max_consecutive_losses, 0),
+		       timezone
 		FROM Users
 		WHERE chat_id = $1
 	`
 
 	var user User
-	if err := r.conn.QueryRow(query, id).Scan(&user.Name, &user.ChatID); err != nil {
+	if err := r.conn.QueryRow(query, id).Scan(&user.Name, &user.ChatID, &user.HistoryPageSize, &user.Balance, &user.CurrentAccountID,
+		&user.Limits.MaxDailyLoss, &user.Limits.MaxDailyTrades, &user.Limits.MaxConsecutiveLosses,
+		&user.Timezone); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -57,32 +96,211 @@ func (r *repository) getUser(id int64) (*User, error) {
 	return &user, nil
 }
 
+// saveDeal сохраняет сделку вместе с проверками правил и вложениями одной транзакцией
 func (r *repository) saveDeal(d *Deal, userID int64) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
 	var pairID int64
-	err := r.conn.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1", d.Pair).Scan(&pairID)
+	err = tx.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1", d.Pair).Scan(&pairID)
 	if err != nil {
 		return err
 	}
 
 	query := `
-		INSERT INTO Deals (user_id, pair_id, buy_price, sell_price, profit, profit_percent, deal_date)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO Deals (user_id, pair_id, buy_price, sell_price, profit, profit_percent, deal_date, strategy_id, amount, stop_loss, take_profit, account_id, entry_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, NULLIF($10::DECIMAL, 0), NULLIF($11::DECIMAL, 0), NULLIF($12, 0), $13)
+		RETURNING deal_id
 	`
-	_, err = r.conn.Exec(query, userID, pairID, d.BuyPrice, d.SellPrice, d.Profit, d.ProfitPercent, d.Date)
+	// У открытой позиции еще нет цены продажи и прибыли
+	var sellPrice, profit, profitPercent any = d.SellPrice, d.Profit, d.ProfitPercent
+	if d.Open {
+		sellPrice, profit, profitPercent = nil, nil, nil
+	}
+
+	var dealID int64
+	err = tx.QueryRow(query, userID, pairID, d.BuyPrice, sellPrice, profit, profitPercent, d.Date, d.StrategyID,
+		d.Amount, d.StopLoss, d.TakeProfit, d.AccountID, sql.NullTime{Time: d.EntryDate, Valid: !d.EntryDate.IsZero()}).Scan(&dealID)
 	if err != nil {
 		return err
 	}
 
+	for ruleID, followed := range d.RuleChecks {
+		_, err := tx.Exec("INSERT INTO DealRuleChecks (deal_id, rule_id, followed) VALUES ($1, $2, $3)", dealID, ruleID, followed)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := saveDealAttachments(tx, dealID, d.Attachments); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Номер сделки присваиваем только после коммита, чтобы при ошибке сделка осталась несохраненной
+	d.ID = dealID
+	for _, a := range d.Attachments {
+		a.DealID = dealID
+	}
+
 	return nil
 }
 
-func (r *repository) getDeals(userID int64) ([]*Deal, error) {
+// saveDealAttachments сохраняет вложения новой сделки внутри транзакции
+func saveDealAttachments(tx *sql.Tx, dealID int64, attachments []*Attachment) error {
 	query := `
-        SELECT d.deal_id, p.pair_name, d.buy_price, d.sell_price, d.profit, d.profit_percent, d.deal_date
-        FROM Deals AS d
-        JOIN Pairs AS p ON d.pair_id = p.pair_id
-        WHERE d.user_id = $1
-        ORDER BY d.deal_date DESC
+		INSERT INTO DealAttachments (deal_id, file_id, kind)
+		VALUES ($1, $2, $3)
+		RETURNING attachment_id
+	`
+	for _, a := range attachments {
+		if err := tx.QueryRow(query, dealID, a.FileID, a.Kind).Scan(&a.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeDeal закрывает открытую позицию по цене продажи
+func (r *repository) closeDeal(d *Deal, userID int64) error {
+	query := `
+		UPDATE Deals
+		SET sell_price = $1, profit = $2, profit_percent = $3, deal_date = $4
+		WHERE deal_id = $5 AND user_id = $6 AND sell_price IS NULL
+	`
+	res, err := r.conn.Exec(query, d.SellPrice, d.Profit, d.ProfitPercent, d.Date, d.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("open position %v not found", d.ID)
+	}
+
+	for _, a := range d.Attachments {
+		a.DealID = d.ID
+		if err := r.saveAttachment(a); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getOpenPositions возвращает открытые позиции пользователя, начиная со старых
+func (r *repository) getOpenPositions(userID int64) ([]*Deal, error) {
+	query := selectDealsQuery + `
+        WHERE d.user_id = $1 AND d.sell_price IS NULL
+        ORDER BY d.deal_date, d.deal_id
+    `
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeals(rows)
+}
+
+func (r *repository) getDeal(userID, dealID int64) (*Deal, error) {
+	query := selectDealsQuery + `
+        WHERE d.user_id = $1 AND d.deal_id = $2
+    `
+
+	rows, err := r.conn.Query(query, userID, dealID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deals, err := scanDeals(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deals) == 0 {
+		return nil, nil
+	}
+
+	return deals[0], nil
+}
+
+// saveDealJournal сохраняет записи журнала сделки и ее теги одной транзакцией, пустые значения сохраняются как NULL
+func (r *repository) saveDealJournal(d *Deal, userID int64) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	query := `
+		UPDATE Deals
+		SET note = NULLIF($1, ''), strategy_id = NULLIF($2, 0), execution_rating = NULLIF($3, 0), emotion = NULLIF($4, '')
+		WHERE deal_id = $5 AND user_id = $6
+	`
+	res, err := tx.Exec(query, d.Note, d.StrategyID, d.ExecutionRating, d.Emotion, d.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Не даем трогать теги чужой сделки
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	if err := saveDealTags(tx, userID, d.ID, d.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveDealTags заменяет теги сделки, новые теги добавляются в словарь тегов пользователя
+func saveDealTags(tx *sql.Tx, userID, dealID int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM DealTags WHERE deal_id = $1", dealID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		query := `
+			INSERT INTO Tags (user_id, name)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING tag_id
+		`
+
+		var tagID int64
+		if err := tx.QueryRow(query, userID, tag).Scan(&tagID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec("INSERT INTO DealTags (deal_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", dealID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getDeals возвращает все закрытые сделки пользователя, от новых к старым
+func (r *repository) getDeals(userID int64) ([]*Deal, error) {
+	query := selectDealsQuery + `
+        WHERE d.user_id = $1 AND d.sell_price IS NOT NULL
+        ORDER BY d.deal_date DESC, d.deal_id DESC
     `
 
 	rows, err := r.conn.Query(query, userID)
@@ -91,13 +309,120 @@ func (r *repository) getDeals(userID int64) ([]*Deal, error) {
 	}
 	defer rows.Close()
 
+	return scanDeals(rows)
+}
+
+// getOlderDeals возвращает не больше limit сделок, которые идут в истории после курсора.
+// Если курсор nil, выборка начинается с самой новой сделки.
+func (r *repository) getOlderDeals(userID int64, filter dealFilter, cursor *dealCursor, limit int) ([]*Deal, error) {
+	args := []any{userID, limit}
+	conditions, args := filter.where(args)
+
+	if cursor != nil {
+		args = append(args, cursor.Date, cursor.ID)
+		conditions += fmt.Sprintf(" AND (d.deal_date, d.deal_id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query := selectDealsQuery + `
+        WHERE d.user_id = $1` + conditions + `
+        ORDER BY d.deal_date DESC, d.deal_id DESC
+        LIMIT $2
+    `
+
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeals(rows)
+}
+
+// getFilteredDeals возвращает все сделки, подходящие под фильтр истории, от новых к старым
+func (r *repository) getFilteredDeals(userID int64, filter dealFilter) ([]*Deal, error) {
+	conditions, args := filter.where([]any{userID})
+
+	query := selectDealsQuery + `
+        WHERE d.user_id = $1` + conditions + `
+        ORDER BY d.deal_date DESC, d.deal_id DESC
+    `
+
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeals(rows)
+}
+
+// getNewerDeals возвращает не больше limit сделок, которые идут в истории перед курсором.
+// Сделки возвращаются в том же порядке, что и в истории: от новых к старым.
+func (r *repository) getNewerDeals(userID int64, filter dealFilter, cursor dealCursor, limit int) ([]*Deal, error) {
+	args := []any{userID, cursor.Date, cursor.ID, limit}
+	conditions, args := filter.where(args)
+
+	query := selectDealsQuery + `
+        WHERE d.user_id = $1 AND (d.deal_date, d.deal_id) > ($2, $3)` + conditions + `
+        ORDER BY d.deal_date ASC, d.deal_id ASC
+        LIMIT $4
+    `
+
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deals, err := scanDeals(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(deals)-1; i < j; i, j = i+1, j-1 {
+		deals[i], deals[j] = deals[j], deals[i]
+	}
+
+	return deals, nil
+}
+
+// countDeals считает сделки пользователя. Если курсор задан, считаются только сделки перед ним.
+func (r *repository) countDeals(userID int64, filter dealFilter, cursor *dealCursor) (int, error) {
+	args := []any{userID}
+	conditions, args := filter.where(args)
+
+	if cursor != nil {
+		args = append(args, cursor.Date, cursor.ID)
+		conditions += fmt.Sprintf(" AND (d.deal_date, d.deal_id) > ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query := "SELECT COUNT(*) FROM Deals AS d WHERE d.user_id = $1" + conditions
+
+	var count int
+	if err := r.conn.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func scanDeals(rows *sql.Rows) ([]*Deal, error) {
 	var deals []*Deal
 
 	for rows.Next() {
 		var deal Deal
-		if err := rows.Scan(&deal.ID, &deal.Pair, &deal.BuyPrice, &deal.SellPrice, &deal.Profit, &deal.ProfitPercent, &deal.Date); err != nil {
+		var tags string
+		var entryDate sql.NullTime
+		if err := rows.Scan(&deal.ID, &deal.Pair, &deal.BuyPrice, &deal.SellPrice, &deal.Profit, &deal.ProfitPercent, &deal.Date,
+			&deal.Open,
+			&deal.Note, &deal.StrategyID, &deal.Strategy, &deal.ExecutionRating, &deal.Emotion,
+			&deal.AttachmentCount, &tags,
+			&deal.Amount, &deal.StopLoss, &deal.TakeProfit,
+			&deal.AccountID, &entryDate); err != nil {
 			return nil, err
 		}
+		deal.Tags = strings.Fields(tags)
+		deal.EntryDate = entryDate.Time
 		deals = append(deals, &deal)
 	}
 	if err := rows.Err(); err != nil {
@@ -107,82 +432,1460 @@ func (r *repository) getDeals(userID int64) ([]*Deal, error) {
 	return deals, nil
 }
 
-func (r *repository) savePair(userID int64, pair string) error {
-	// Проверяем, существует ли уже такая пара в таблице PAIRS
-	var pairID int64
-	err := r.conn.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1", pair).Scan(&pairID)
-	if errors.Is(err, sql.ErrNoRows) { // Если пары нет, создаем ее
-		_, err := r.conn.Exec("INSERT INTO PAIRS (pair_name) VALUES ($1)", pair)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-
-		// Получаем ChatID созданной пары
-		err = r.conn.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1", pair).Scan(&pairID)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-	} else if err != nil {
-		log.Println(err)
+func (r *repository) setHistoryPageSize(userID int64, size int) error {
+	_, err := r.conn.Exec("UPDATE Users SET history_page_size = $1 WHERE chat_id = $2", size, userID)
+	if err != nil {
 		return err
 	}
 
-	// Добавляем запись о паре для пользователя в таблицу UserPairs
-	_, err = r.conn.Exec("INSERT INTO UserPairs (user_id, pair_id) VALUES ($1, $2)", userID, pairID)
+	return nil
+}
+
+func (r *repository) setBalance(userID int64, balance decimal.Decimal) error {
+	_, err := r.conn.Exec("UPDATE Users SET balance = $1 WHERE chat_id = $2", balance, userID)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
 	return nil
 }
 
-func (r *repository) getPairs(id int64) ([]string, error) {
+// setCurrentAccount переключает текущий портфель, 0 - все портфели
+func (r *repository) setCurrentAccount(userID int64, accountID int64) error {
 	query := `
-		SELECT p.pair_name
-		FROM UserPairs AS up
-		JOIN Pairs AS p ON up.pair_id = p.pair_id
-		WHERE up.user_id = $1
+		UPDATE Users
+		SET current_account_id = (SELECT account_id FROM Accounts WHERE account_id = NULLIF($1, 0) AND user_id = $2)
+		WHERE chat_id = $2
 	`
+	if _, err := r.conn.Exec(query, accountID, userID); err != nil {
+		return err
+	}
 
-	rows, err := r.conn.Query(query, id)
+	return nil
+}
+
+func (r *repository) setLimits(userID int64, limits TradingLimits) error {
+	query := `
+		UPDATE Users
+		SET max_daily_loss = NULLIF($1::DECIMAL, 0), max_daily_trades = NULLIF($2, 0), max_consecutive_losses = NULLIF($3, 0)
+		WHERE chat_id = $4
+	`
+	if _, err := r.conn.Exec(query, limits.MaxDailyLoss, limits.MaxDailyTrades, limits.MaxConsecutiveLosses, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// saveLimitBreach записывает нарушение лимита. За день пользователя каждый лимит записывается один раз,
+// чтобы сделки после уже нарушенного лимита не увеличивали число нарушений
+func (r *repository) saveLimitBreach(userID int64, kind LimitKind, dealID int64, date time.Time) error {
+	query := `
+		INSERT INTO LimitBreaches (user_id, limit_kind, deal_id, breach_date, breach_day)
+		SELECT $1, $2, NULLIF($3, 0), $4::TIMESTAMP, ($4::TIMESTAMP AT TIME ZONE 'UTC' AT TIME ZONE timezone)::DATE
+		FROM Users
+		WHERE chat_id = $1
+		ON CONFLICT (user_id, limit_kind, breach_day) DO NOTHING
+	`
+	if _, err := r.conn.Exec(query, userID, kind, dealID, date.UTC()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getLimitBreaches возвращает количество нарушений и число дней с нарушениями по каждому лимиту
+func (r *repository) getLimitBreaches(userID int64) (map[LimitKind]limitBreachStats, error) {
+	query := `
+		SELECT b.limit_kind, COUNT(*), COUNT(DISTINCT (b.breach_date AT TIME ZONE 'UTC' AT TIME ZONE u.timezone)::DATE)
+		FROM LimitBreaches AS b
+		JOIN Users AS u ON b.user_id = u.chat_id
+		WHERE b.user_id = $1
+		GROUP BY b.limit_kind
+	`
+
+	rows, err := r.conn.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var pairs []string
+	breaches := make(map[LimitKind]limitBreachStats)
 
 	for rows.Next() {
-		var pair string
-		if err := rows.Scan(&pair); err != nil {
+		var kind LimitKind
+		var stats limitBreachStats
+		if err := rows.Scan(&kind, &stats.Count, &stats.Days); err != nil {
 			return nil, err
 		}
-		pairs = append(pairs, pair)
+		breaches[kind] = stats
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return pairs, nil
+	return breaches, nil
 }
 
-func (r *repository) getPair(id int64, pair string) (bool, error) {
+func (r *repository) setTimezone(userID int64, timezone string) error {
+	if _, err := r.conn.Exec("UPDATE Users SET timezone = $1 WHERE chat_id = $2", timezone, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) getReportSchedules(userID int64) ([]*ReportSchedule, error) {
 	query := `
-		SELECT EXISTS (
-			SELECT 1
-			FROM UserPairs AS up
-			JOIN Pairs AS p ON up.pair_id = p.pair_id
-			WHERE up.user_id = $1 AND p.pair_name = $2
-		)
+		SELECT s.user_id, s.period, s.hour, s.next_run, u.timezone
+		FROM ReportSchedules AS s
+		JOIN Users AS u ON s.user_id = u.chat_id
+		WHERE s.user_id = $1
 	`
 
-	var exists bool
-	if err := r.conn.QueryRow(query, id, pair).Scan(&exists); err != nil {
-		return false, err
+	return r.queryReportSchedules(query, userID)
+}
+
+// getDueReportSchedules возвращает расписания, время отправки которых наступило
+func (r *repository) getDueReportSchedules(now time.Time) ([]*ReportSchedule, error) {
+	query := `
+		SELECT s.user_id, s.period, s.hour, s.next_run, u.timezone
+		FROM ReportSchedules AS s
+		JOIN Users AS u ON s.user_id = u.chat_id
+		WHERE s.next_run <= $1
+		ORDER BY s.next_run
+	`
+
+	return r.queryReportSchedules(query, now.UTC())
+}
+
+func (r *repository) queryReportSchedules(query string, args ...any) ([]*ReportSchedule, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return exists, nil
+	var schedules []*ReportSchedule
+
+	for rows.Next() {
+		var s ReportSchedule
+		if err := rows.Scan(&s.UserID, &s.Period, &s.Hour, &s.NextRun, &s.Timezone); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (r *repository) saveReportSchedule(s *ReportSchedule) error {
+	query := `
+		INSERT INTO ReportSchedules (user_id, period, hour, next_run)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, period) DO UPDATE SET hour = EXCLUDED.hour, next_run = EXCLUDED.next_run
+	`
+	if _, err := r.conn.Exec(query, s.UserID, s.Period, s.Hour, s.NextRun.UTC()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) deleteReportSchedule(userID int64, period ReportPeriod) error {
+	if _, err := r.conn.Exec("DELETE FROM ReportSchedules WHERE user_id = $1 AND period = $2", userID, period); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) savePriceAlert(a *PriceAlert) error {
+	query := `
+		INSERT INTO PriceAlerts (user_id, pair, direction, level, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING alert_id
+	`
+	if err := r.conn.QueryRow(query, a.UserID, a.Pair, a.Direction, a.Level, a.CreatedAt).Scan(&a.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getPriceAlerts возвращает несработавшие уведомления пользователя
+func (r *repository) getPriceAlerts(userID int64) ([]*PriceAlert, error) {
+	query := `
+		SELECT alert_id, user_id, pair, direction, level, created_at
+		FROM PriceAlerts
+		WHERE user_id = $1 AND triggered_at IS NULL
+		ORDER BY alert_id
+	`
+
+	return r.queryPriceAlerts(query, userID)
+}
+
+// getActivePriceAlerts возвращает несработавшие уведомления всех пользователей
+func (r *repository) getActivePriceAlerts() ([]*PriceAlert, error) {
+	query := `
+		SELECT alert_id, user_id, pair, direction, level, created_at
+		FROM PriceAlerts
+		WHERE triggered_at IS NULL
+		ORDER BY alert_id
+	`
+
+	return r.queryPriceAlerts(query)
+}
+
+func (r *repository) queryPriceAlerts(query string, args ...any) ([]*PriceAlert, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*PriceAlert
+
+	for rows.Next() {
+		var a PriceAlert
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Pair, &a.Direction, &a.Level, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// triggerPriceAlert отмечает уведомление сработавшим. Возвращает false, если оно уже сработало или удалено
+func (r *repository) triggerPriceAlert(alertID int64, at time.Time) (bool, error) {
+	res, err := r.conn.Exec("UPDATE PriceAlerts SET triggered_at = $1 WHERE alert_id = $2 AND triggered_at IS NULL", at.UTC(), alertID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) deletePriceAlert(userID, alertID int64) error {
+	if _, err := r.conn.Exec("DELETE FROM PriceAlerts WHERE alert_id = $1 AND user_id = $2", alertID, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getLevelWatchUsers возвращает пользователей, у которых есть открытые позиции со стопом или тейком
+func (r *repository) getLevelWatchUsers() ([]int64, error) {
+	query := `
+		SELECT DISTINCT user_id
+		FROM Deals
+		WHERE sell_price IS NULL AND (stop_loss IS NOT NULL OR take_profit IS NOT NULL)
+	`
+
+	rows, err := r.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []int64
+
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// getLevelHits возвращает уровни открытых позиций пользователя, о достижении которых он уже знает
+func (r *repository) getLevelHits(userID int64) (map[int64]map[LevelKind]bool, error) {
+	query := `
+		SELECT h.deal_id, h.level
+		FROM LevelHits AS h
+		JOIN Deals AS d ON h.deal_id = d.deal_id
+		WHERE d.user_id = $1 AND d.sell_price IS NULL
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make(map[int64]map[LevelKind]bool)
+
+	for rows.Next() {
+		var dealID int64
+		var level LevelKind
+		if err := rows.Scan(&dealID, &level); err != nil {
+			return nil, err
+		}
+		if hits[dealID] == nil {
+			hits[dealID] = make(map[LevelKind]bool)
+		}
+		hits[dealID][level] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hits, nil
+}
+
+// getLevelHitDate возвращает время, когда цена дошла до уровня сделки, или нулевое время, если достижение не сохранено
+func (r *repository) getLevelHitDate(userID, dealID int64, level LevelKind) (time.Time, error) {
+	query := `
+		SELECT h.hit_date
+		FROM LevelHits AS h
+		JOIN Deals AS d ON h.deal_id = d.deal_id
+		WHERE d.user_id = $1 AND h.deal_id = $2 AND h.level = $3
+	`
+
+	var date time.Time
+	if err := r.conn.QueryRow(query, userID, dealID, level).Scan(&date); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	return date.UTC(), nil
+}
+
+// saveLevelHit запоминает достижение уровня. Возвращает false, если оно уже было сохранено
+func (r *repository) saveLevelHit(dealID int64, level LevelKind, price decimal.Decimal, date time.Time) (bool, error) {
+	query := `
+		INSERT INTO LevelHits (deal_id, level, price, hit_date)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (deal_id, level) DO NOTHING
+	`
+	res, err := r.conn.Exec(query, dealID, level, price, date.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) savePair(userID int64, pair string) error {
+	// Проверяем, существует ли уже такая пара в таблице PAIRS
+	var pairID int64
+	err := r.conn.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1", pair).Scan(&pairID)
+	if errors.Is(err, sql.ErrNoRows) { // Если пары нет, создаем ее
+		_, err := r.conn.Exec("INSERT INTO PAIRS (pair_name) VALUES ($1)", pair)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		// Получаем ChatID созданной пары
+		err = r.conn.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1", pair).Scan(&pairID)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	// Добавляем запись о паре для пользователя в таблицу UserPairs
+	_, err = r.conn.Exec("INSERT INTO UserPairs (user_id, pair_id) VALUES ($1, $2)", userID, pairID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) getPairs(id int64) ([]string, error) {
+	query := `
+		SELECT p.pair_name
+		FROM UserPairs AS up
+		JOIN Pairs AS p ON up.pair_id = p.pair_id
+		WHERE up.user_id = $1
+	`
+
+	rows, err := r.conn.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []string
+
+	for rows.Next() {
+		var pair string
+		if err := rows.Scan(&pair); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pairs, nil
+}
+
+func (r *repository) getPair(id int64, pair string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM UserPairs AS up
+			JOIN Pairs AS p ON up.pair_id = p.pair_id
+			WHERE up.user_id = $1 AND p.pair_name = $2
+		)
+	`
+
+	var exists bool
+	if err := r.conn.QueryRow(query, id, pair).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *repository) getStrategies(userID int64) ([]*Strategy, error) {
+	query := `
+		SELECT strategy_id, name, description
+		FROM Strategies
+		WHERE user_id = $1
+		ORDER BY name
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var strategies []*Strategy
+
+	for rows.Next() {
+		var strategy Strategy
+		if err := rows.Scan(&strategy.ID, &strategy.Name, &strategy.Description); err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, &strategy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return strategies, nil
+}
+
+// getStrategy возвращает стратегию пользователя вместе с чек-листом правил
+func (r *repository) getStrategy(userID, strategyID int64) (*Strategy, error) {
+	query := `
+		SELECT strategy_id, name, description
+		FROM Strategies
+		WHERE user_id = $1 AND strategy_id = $2
+	`
+
+	var strategy Strategy
+	if err := r.conn.QueryRow(query, userID, strategyID).Scan(&strategy.ID, &strategy.Name, &strategy.Description); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rules, err := r.getStrategyRules(strategyID)
+	if err != nil {
+		return nil, err
+	}
+	strategy.Rules = rules
+
+	return &strategy, nil
+}
+
+func (r *repository) getStrategyRules(strategyID int64) ([]*StrategyRule, error) {
+	query := `
+		SELECT rule_id, text
+		FROM StrategyRules
+		WHERE strategy_id = $1
+		ORDER BY position
+	`
+
+	rows, err := r.conn.Query(query, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*StrategyRule
+
+	for rows.Next() {
+		var rule StrategyRule
+		if err := rows.Scan(&rule.ID, &rule.Text); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (r *repository) saveStrategy(userID int64, name string) (int64, error) {
+	query := `
+		INSERT INTO Strategies (user_id, name)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING strategy_id
+	`
+
+	var id int64
+	if err := r.conn.QueryRow(query, userID, name).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// createStrategy сохраняет новую стратегию плейбука вместе с правилами
+func (r *repository) createStrategy(userID int64, s *Strategy) error {
+	query := `
+		INSERT INTO Strategies (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING strategy_id
+	`
+	if err := r.conn.QueryRow(query, userID, s.Name, s.Description).Scan(&s.ID); err != nil {
+		return err
+	}
+
+	for i, rule := range s.Rules {
+		query := `
+			INSERT INTO StrategyRules (strategy_id, position, text)
+			VALUES ($1, $2, $3)
+			RETURNING rule_id
+		`
+		if err := r.conn.QueryRow(query, s.ID, i, rule.Text).Scan(&rule.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getDealRuleChecks возвращает отметки о соблюдении правил по всем сделкам пользователя
+func (r *repository) getDealRuleChecks(userID int64) (map[int64]map[int64]bool, error) {
+	query := `
+		SELECT c.deal_id, c.rule_id, c.followed
+		FROM DealRuleChecks AS c
+		JOIN Deals AS d ON c.deal_id = d.deal_id
+		WHERE d.user_id = $1
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := make(map[int64]map[int64]bool)
+
+	for rows.Next() {
+		var dealID, ruleID int64
+		var followed bool
+		if err := rows.Scan(&dealID, &ruleID, &followed); err != nil {
+			return nil, err
+		}
+		if checks[dealID] == nil {
+			checks[dealID] = make(map[int64]bool)
+		}
+		checks[dealID][ruleID] = followed
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+func (r *repository) saveAttachment(a *Attachment) error {
+	query := `
+		INSERT INTO DealAttachments (deal_id, file_id, kind)
+		VALUES ($1, $2, $3)
+		RETURNING attachment_id
+	`
+	if err := r.conn.QueryRow(query, a.DealID, a.FileID, a.Kind).Scan(&a.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getAttachments возвращает вложения сделки, если сделка принадлежит пользователю
+func (r *repository) getAttachments(userID, dealID int64) ([]*Attachment, error) {
+	query := `
+		SELECT a.attachment_id, a.deal_id, a.file_id, a.kind
+		FROM DealAttachments AS a
+		JOIN Deals AS d ON a.deal_id = d.deal_id
+		WHERE d.user_id = $1 AND a.deal_id = $2
+		ORDER BY a.attachment_id
+	`
+
+	rows, err := r.conn.Query(query, userID, dealID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*Attachment
+
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.DealID, &a.FileID, &a.Kind); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// getTags возвращает теги пользователя, начиная с недавно использованных
+func (r *repository) getTags(userID int64, limit int) ([]*Tag, error) {
+	query := `
+		SELECT t.tag_id, t.name
+		FROM Tags AS t
+		LEFT JOIN DealTags AS dt ON t.tag_id = dt.tag_id
+		WHERE t.user_id = $1
+		GROUP BY t.tag_id, t.name
+		ORDER BY MAX(dt.deal_id) DESC NULLS LAST, t.name
+		LIMIT $2
+	`
+
+	rows, err := r.conn.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*Tag
+
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (r *repository) getTag(userID, tagID int64) (*Tag, error) {
+	var tag Tag
+	err := r.conn.QueryRow("SELECT tag_id, name FROM Tags WHERE user_id = $1 AND tag_id = $2", userID, tagID).Scan(&tag.ID, &tag.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+func (r *repository) createAccount(userID int64, a *Account) error {
+	query := `
+		INSERT INTO Accounts (user_id, name, starting_balance, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING account_id
+	`
+	if err := r.conn.QueryRow(query, userID, a.Name, a.StartingBalance, a.CreatedAt).Scan(&a.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) getAccounts(userID int64) ([]*Account, error) {
+	query := `
+		SELECT account_id, name, starting_balance, created_at
+		FROM Accounts
+		WHERE user_id = $1
+		ORDER BY account_id
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*Account
+
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.ID, &a.Name, &a.StartingBalance, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// saveCashFlow добавляет движение средств, если счет принадлежит пользователю
+func (r *repository) saveCashFlow(userID int64, f *CashFlow) error {
+	query := `
+		INSERT INTO CashFlows (account_id, amount, flow_date)
+		SELECT account_id, $3, $4
+		FROM Accounts
+		WHERE account_id = $1 AND user_id = $2
+		RETURNING cash_flow_id
+	`
+	if err := r.conn.QueryRow(query, f.AccountID, userID, f.Amount, f.Date).Scan(&f.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getCashFlows возвращает движения средств по всем счетам пользователя в хронологическом порядке
+func (r *repository) getCashFlows(userID int64) ([]*CashFlow, error) {
+	query := `
+		SELECT f.cash_flow_id, f.account_id, f.amount, f.flow_date
+		FROM CashFlows AS f
+		JOIN Accounts AS a ON f.account_id = a.account_id
+		WHERE a.user_id = $1
+		ORDER BY f.flow_date, f.cash_flow_id
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flows []*CashFlow
+
+	for rows.Next() {
+		var f CashFlow
+		if err := rows.Scan(&f.ID, &f.AccountID, &f.Amount, &f.Date); err != nil {
+			return nil, err
+		}
+		flows = append(flows, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return flows, nil
+}
+
+// getAllAttachments возвращает вложения всех сделок пользователя по ID сделки
+func (r *repository) getAllAttachments(userID int64) (map[int64][]*Attachment, error) {
+	query := `
+		SELECT a.attachment_id, a.deal_id, a.file_id, a.kind
+		FROM DealAttachments AS a
+		JOIN Deals AS d ON a.deal_id = d.deal_id
+		WHERE d.user_id = $1
+		ORDER BY a.attachment_id
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[int64][]*Attachment)
+
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.DealID, &a.FileID, &a.Kind); err != nil {
+			return nil, err
+		}
+		attachments[a.DealID] = append(attachments[a.DealID], &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// getLimitBreachList возвращает все нарушения лимитов пользователя в хронологическом порядке
+func (r *repository) getLimitBreachList(userID int64) ([]*LimitBreach, error) {
+	query := `
+		SELECT limit_kind, COALESCE(deal_id, 0), breach_date
+		FROM LimitBreaches
+		WHERE user_id = $1
+		ORDER BY breach_date, breach_id
+	`
+
+	rows, err := r.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breaches []*LimitBreach
+
+	for rows.Next() {
+		var b LimitBreach
+		if err := rows.Scan(&b.Kind, &b.DealID, &b.Date); err != nil {
+			return nil, err
+		}
+		breaches = append(breaches, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return breaches, nil
+}
+
+// restoreBackup восстанавливает архив в журнал пользователя одной транзакцией:
+// при любой ошибке журнал остается прежним. keepAttachments - переносить ли file_id вложений
+func (r *repository) restoreBackup(userID int64, a *backupArchive, mode restoreMode, keepAttachments bool) (*restoreResult, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	rs := &restorer{
+		tx:              tx,
+		userID:          userID,
+		mode:            mode,
+		keepAttachments: keepAttachments,
+		pairs:           make(map[string]int64),
+		tags:            make(map[string]int64),
+		accounts:        make(map[int64]int64),
+		strategies:      make(map[int64]int64),
+		rules:           make(map[int64]int64),
+		deals:           make(map[int64]int64),
+	}
+	if err := rs.restore(a); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &rs.result, nil
+}
+
+// restorer переносит записи архива в базу внутри транзакции и запоминает,
+// какие ID архива каким ID в базе соответствуют
+type restorer struct {
+	tx              *sql.Tx
+	userID          int64
+	mode            restoreMode
+	keepAttachments bool
+	// У пользователя еще нет журнала, совпадающих записей быть не может
+	empty bool
+
+	pairs      map[string]int64
+	tags       map[string]int64
+	accounts   map[int64]int64
+	strategies map[int64]int64
+	rules      map[int64]int64
+	deals      map[int64]int64
+
+	result restoreResult
+}
+
+func (rs *restorer) restore(a *backupArchive) error {
+	query := `
+		SELECT NOT EXISTS (SELECT 1 FROM Deals WHERE user_id = $1)
+		   AND NOT EXISTS (SELECT 1 FROM Accounts WHERE user_id = $1)
+		   AND NOT EXISTS (SELECT 1 FROM Strategies WHERE user_id = $1)
+	`
+	if err := rs.tx.QueryRow(query, rs.userID).Scan(&rs.empty); err != nil {
+		return err
+	}
+
+	for _, pair := range a.Pairs {
+		if _, err := rs.pairID(pair); err != nil {
+			return err
+		}
+	}
+	for _, account := range a.Accounts {
+		if err := rs.restoreAccount(account); err != nil {
+			return err
+		}
+	}
+	for _, strategy := range a.Strategies {
+		if err := rs.restoreStrategy(strategy); err != nil {
+			return err
+		}
+	}
+	for _, tag := range a.Tags {
+		if _, err := rs.tagID(tag); err != nil {
+			return err
+		}
+	}
+	for _, deal := range a.Deals {
+		if err := rs.restoreDeal(deal); err != nil {
+			return err
+		}
+	}
+	for _, alert := range a.Alerts {
+		if err := rs.restoreAlert(alert); err != nil {
+			return err
+		}
+	}
+
+	// Настройки одни на пользователя, поэтому копию сделать нельзя: они заменяются только при перезаписи
+	if rs.empty || rs.mode == restoreOverwrite {
+		if err := rs.restoreSettings(a.Settings); err != nil {
+			return err
+		}
+	}
+
+	// День нарушения считается в часовом поясе пользователя, поэтому нарушения идут после настроек
+	for _, breach := range a.Breaches {
+		if err := rs.restoreBreach(breach); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pairID находит или создает пару и добавляет ее в список пар пользователя
+func (rs *restorer) pairID(name string) (int64, error) {
+	if id, ok := rs.pairs[name]; ok {
+		return id, nil
+	}
+
+	var id int64
+	err := rs.tx.QueryRow("SELECT pair_id FROM PAIRS WHERE pair_name = $1 ORDER BY pair_id LIMIT 1", name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = rs.tx.QueryRow("INSERT INTO PAIRS (pair_name) VALUES ($1) RETURNING pair_id", name).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := rs.tx.Exec("INSERT INTO UserPairs (user_id, pair_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", rs.userID, id); err != nil {
+		return 0, err
+	}
+
+	rs.pairs[name] = id
+	return id, nil
+}
+
+// tagID находит или создает тег пользователя. Теги с одинаковым именем всегда объединяются
+func (rs *restorer) tagID(name string) (int64, error) {
+	if id, ok := rs.tags[name]; ok {
+		return id, nil
+	}
+
+	query := `
+		INSERT INTO Tags (user_id, name)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING tag_id
+	`
+
+	var id int64
+	if err := rs.tx.QueryRow(query, rs.userID, name).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	rs.tags[name] = id
+	return id, nil
+}
+
+// uniqueName подбирает для копии имя вида "Имя (2)", которое еще не занято в таблице
+func (rs *restorer) uniqueName(table, name string) (string, error) {
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE user_id = $1 AND name = $2)", table)
+
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+
+		var exists bool
+		if err := rs.tx.QueryRow(query, rs.userID, candidate).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+}
+
+// findByName возвращает ID записи пользователя с таким именем, 0 если ее нет
+func (rs *restorer) findByName(table, idColumn, name string) (int64, error) {
+	if rs.empty {
+		return 0, nil
+	}
+
+	var id int64
+	err := rs.tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE user_id = $1 AND name = $2", idColumn, table), rs.userID, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return id, err
+}
+
+func (rs *restorer) restoreAccount(a *backupAccount) error {
+	existing, err := rs.findByName("Accounts", "account_id", a.Name)
+	if err != nil {
+		return err
+	}
+
+	name := a.Name
+	if existing != 0 {
+		switch rs.mode {
+		case restoreSkip:
+			rs.accounts[a.ID] = existing
+			return nil
+		case restoreOverwrite:
+			rs.accounts[a.ID] = existing
+			if _, err := rs.tx.Exec("UPDATE Accounts SET starting_balance = $1, created_at = $2 WHERE account_id = $3", a.StartingBalance, a.CreatedAt.UTC(), existing); err != nil {
+				return err
+			}
+			if _, err := rs.tx.Exec("DELETE FROM CashFlows WHERE account_id = $1", existing); err != nil {
+				return err
+			}
+			return rs.insertCashFlows(existing, a.CashFlows)
+		default:
+			if name, err = rs.uniqueName("Accounts", a.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `
+		INSERT INTO Accounts (user_id, name, starting_balance, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING account_id
+	`
+
+	var id int64
+	if err := rs.tx.QueryRow(query, rs.userID, name, a.StartingBalance, a.CreatedAt.UTC()).Scan(&id); err != nil {
+		return err
+	}
+	rs.accounts[a.ID] = id
+	rs.result.Accounts++
+
+	return rs.insertCashFlows(id, a.CashFlows)
+}
+
+func (rs *restorer) insertCashFlows(accountID int64, flows []*backupCashFlow) error {
+	for _, f := range flows {
+		if _, err := rs.tx.Exec("INSERT INTO CashFlows (account_id, amount, flow_date) VALUES ($1, $2, $3)", accountID, f.Amount, f.Date.UTC()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rs *restorer) restoreStrategy(s *backupStrategy) error {
+	existing, err := rs.findByName("Strategies", "strategy_id", s.Name)
+	if err != nil {
+		return err
+	}
+
+	name := s.Name
+	if existing != 0 {
+		switch rs.mode {
+		case restoreSkip:
+			rs.strategies[s.ID] = existing
+			return rs.syncRules(existing, s.Rules, false)
+		case restoreOverwrite:
+			rs.strategies[s.ID] = existing
+			if _, err := rs.tx.Exec("UPDATE Strategies SET description = $1 WHERE strategy_id = $2", s.Description, existing); err != nil {
+				return err
+			}
+			return rs.syncRules(existing, s.Rules, true)
+		default:
+			if name, err = rs.uniqueName("Strategies", s.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `
+		INSERT INTO Strategies (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING strategy_id
+	`
+
+	var id int64
+	if err := rs.tx.QueryRow(query, rs.userID, name, s.Description).Scan(&id); err != nil {
+		return err
+	}
+	rs.strategies[s.ID] = id
+	rs.result.Strategies++
+
+	return rs.syncRules(id, s.Rules, true)
+}
+
+// syncRules сопоставляет правила архива с правилами стратегии по тексту. При update недостающие
+// правила добавляются, лишние удаляются, а порядок берется из архива; иначе стратегия не меняется
+// и отметки по правилам, которых в ней нет, при восстановлении теряются
+func (rs *restorer) syncRules(strategyID int64, rules []*backupRule, update bool) error {
+	rows, err := rs.tx.Query("SELECT rule_id, text FROM StrategyRules WHERE strategy_id = $1 ORDER BY position", strategyID)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := existing[text]; !ok {
+			existing[text] = id
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, rule := range rules {
+		if id, ok := existing[rule.Text]; ok {
+			rs.rules[rule.ID] = id
+			delete(existing, rule.Text)
+			if update {
+				if _, err := rs.tx.Exec("UPDATE StrategyRules SET position = $1 WHERE rule_id = $2", i, id); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !update {
+			continue
+		}
+
+		query := `
+			INSERT INTO StrategyRules (strategy_id, position, text)
+			VALUES ($1, $2, $3)
+			RETURNING rule_id
+		`
+		var id int64
+		if err := rs.tx.QueryRow(query, strategyID, i, rule.Text).Scan(&id); err != nil {
+			return err
+		}
+		rs.rules[rule.ID] = id
+	}
+
+	if !update {
+		return nil
+	}
+	for _, id := range existing {
+		if _, err := rs.tx.Exec("DELETE FROM StrategyRules WHERE rule_id = $1", id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findDeal ищет в журнале ту же сделку: пара, дата, цена покупки, количество и статус совпадают
+func (rs *restorer) findDeal(pairID int64, d *backupDeal) (int64, error) {
+	if rs.empty {
+		return 0, nil
+	}
+
+	query := `
+		SELECT deal_id
+		FROM Deals
+		WHERE user_id = $1 AND pair_id = $2 AND deal_date = $3 AND buy_price = $4 AND COALESCE(amount, 0) = $5 AND (sell_price IS NULL) = $6
+		ORDER BY deal_id
+		LIMIT 1
+	`
+
+	var id int64
+	err := rs.tx.QueryRow(query, rs.userID, pairID, d.Date.UTC(), d.BuyPrice, d.Amount, d.Open).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return id, err
+}
+
+func (rs *restorer) restoreDeal(d *backupDeal) error {
+	pairID, err := rs.pairID(d.Pair)
+	if err != nil {
+		return err
+	}
+
+	existing, err := rs.findDeal(pairID, d)
+	if err != nil {
+		return err
+	}
+
+	// У открытой позиции еще нет цены продажи и прибыли
+	var sellPrice, profit, profitPercent any = d.SellPrice, d.Profit, d.ProfitPercent
+	if d.Open {
+		sellPrice, profit, profitPercent = nil, nil, nil
+	}
+	var entryDate sql.NullTime
+	if d.EntryDate != nil {
+		entryDate = sql.NullTime{Time: d.EntryDate.UTC(), Valid: true}
+	}
+	args := []any{rs.userID, pairID, d.BuyPrice, sellPrice, profit, profitPercent, d.Date.UTC(),
+		d.Note, rs.strategies[d.StrategyID], d.ExecutionRating, d.Emotion,
+		d.Amount, d.StopLoss, d.TakeProfit, rs.accounts[d.AccountID], entryDate}
+
+	var id int64
+	var replace bool
+	switch {
+	case existing != 0 && rs.mode == restoreSkip:
+		rs.deals[d.ID] = existing
+		rs.result.DealsSkipped++
+		return nil
+	case existing != 0 && rs.mode == restoreOverwrite:
+		query := `
+			UPDATE Deals
+			SET pair_id = $2, buy_price = $3, sell_price = $4, profit = $5, profit_percent = $6, deal_date = $7,
+			    note = NULLIF($8, ''), strategy_id = NULLIF($9, 0), execution_rating = NULLIF($10, 0), emotion = NULLIF($11, ''),
+			    amount = $12, stop_loss = NULLIF($13::DECIMAL, 0), take_profit = NULLIF($14::DECIMAL, 0), account_id = NULLIF($15, 0), entry_date = $16
+			WHERE user_id = $1 AND deal_id = $17
+		`
+		if _, err := rs.tx.Exec(query, append(args, existing)...); err != nil {
+			return err
+		}
+		id, replace = existing, true
+		rs.result.DealsUpdated++
+	default:
+		query := `
+			INSERT INTO Deals (user_id, pair_id, buy_price, sell_price, profit, profit_percent, deal_date,
+			                   note, strategy_id, execution_rating, emotion,
+			                   amount, stop_loss, take_profit, account_id, entry_date)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, 0), NULLIF($10, 0), NULLIF($11, ''),
+			        $12, NULLIF($13::DECIMAL, 0), NULLIF($14::DECIMAL, 0), NULLIF($15, 0), $16)
+			RETURNING deal_id
+		`
+		if err := rs.tx.QueryRow(query, args...).Scan(&id); err != nil {
+			return err
+		}
+		rs.result.DealsAdded++
+	}
+	rs.deals[d.ID] = id
+
+	return rs.restoreDealDetails(id, d, replace)
+}
+
+// restoreDealDetails записывает теги, отметки правил и вложения сделки. У перезаписываемой
+// сделки старые заменяются, но вложения без переноса file_id остаются прежними
+func (rs *restorer) restoreDealDetails(dealID int64, d *backupDeal, replace bool) error {
+	if replace {
+		if _, err := rs.tx.Exec("DELETE FROM DealTags WHERE deal_id = $1", dealID); err != nil {
+			return err
+		}
+		if _, err := rs.tx.Exec("DELETE FROM DealRuleChecks WHERE deal_id = $1", dealID); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range d.Tags {
+		tagID, err := rs.tagID(tag)
+		if err != nil {
+			return err
+		}
+		if _, err := rs.tx.Exec("INSERT INTO DealTags (deal_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", dealID, tagID); err != nil {
+			return err
+		}
+	}
+
+	for ruleID, followed := range d.RuleChecks {
+		id, ok := rs.rules[ruleID]
+		if !ok {
+			continue
+		}
+		if _, err := rs.tx.Exec("INSERT INTO DealRuleChecks (deal_id, rule_id, followed) VALUES ($1, $2, $3)", dealID, id, followed); err != nil {
+			return err
+		}
+	}
+
+	if !rs.keepAttachments {
+		rs.result.DroppedAttachments += len(d.Attachments)
+		return nil
+	}
+
+	if replace {
+		if _, err := rs.tx.Exec("DELETE FROM DealAttachments WHERE deal_id = $1", dealID); err != nil {
+			return err
+		}
+	}
+	for _, a := range d.Attachments {
+		if _, err := rs.tx.Exec("INSERT INTO DealAttachments (deal_id, file_id, kind) VALUES ($1, $2, $3)", dealID, a.FileID, a.Kind); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreBreach добавляет нарушение лимита, если в тот же день такой лимит еще не нарушался
+func (rs *restorer) restoreBreach(b *backupBreach) error {
+	query := `
+		INSERT INTO LimitBreaches (user_id, limit_kind, deal_id, breach_date, breach_day)
+		SELECT $1, $2, NULLIF($3, 0), $4::TIMESTAMP, ($4::TIMESTAMP AT TIME ZONE 'UTC' AT TIME ZONE timezone)::DATE
+		FROM Users
+		WHERE chat_id = $1
+		ON CONFLICT (user_id, limit_kind, breach_day) DO NOTHING
+	`
+	_, err := rs.tx.Exec(query, rs.userID, b.Kind, rs.deals[b.DealID], b.Date.UTC())
+
+	return err
+}
+
+// restoreAlert добавляет ценовое уведомление. Совпадающее несработавшее уведомление дублируется только в режиме копий
+func (rs *restorer) restoreAlert(a *backupAlert) error {
+	query := `
+		INSERT INTO PriceAlerts (user_id, pair, direction, level, created_at)
+		SELECT $1, $2, $3, $4, $5
+		WHERE $6 OR NOT EXISTS (
+			SELECT 1 FROM PriceAlerts
+			WHERE user_id = $1 AND pair = $2 AND direction = $3 AND level = $4 AND triggered_at IS NULL
+		)
+	`
+	_, err := rs.tx.Exec(query, rs.userID, a.Pair, a.Direction, a.Level, a.CreatedAt.UTC(), rs.mode == restoreDuplicate)
+
+	return err
+}
+
+func (rs *restorer) restoreSettings(s backupSettings) error {
+	timezone := s.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	pageSize := s.HistoryPageSize
+	if pageSize == 0 {
+		pageSize = defaultHistoryPageSize
+	}
+
+	query := `
+		UPDATE Users
+		SET history_page_size = $1, balance = NULLIF($2::DECIMAL, 0), current_account_id = NULLIF($3, 0),
+		    max_daily_loss = NULLIF($4::DECIMAL, 0), max_daily_trades = NULLIF($5, 0), max_consecutive_losses = NULLIF($6, 0),
+		    timezone = $7
+		WHERE chat_id = $8
+	`
+	if _, err := rs.tx.Exec(query, pageSize, s.Balance, rs.accounts[s.CurrentAccountID],
+		s.MaxDailyLoss, s.MaxDailyTrades, s.MaxConsecutiveLosses, timezone, rs.userID); err != nil {
+		return err
+	}
+
+	// Время следующей отправки считаем заново, чтобы не прислать сразу все пропущенные отчеты
+	loc := userLocation(timezone)
+	for _, report := range s.Reports {
+		query := `
+			INSERT INTO ReportSchedules (user_id, period, hour, next_run)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, period) DO UPDATE SET hour = EXCLUDED.hour, next_run = EXCLUDED.next_run
+		`
+		next := nextReportRun(report.Period, report.Hour, loc, time.Now()).UTC()
+		if _, err := rs.tx.Exec(query, rs.userID, report.Period, report.Hour, next); err != nil {
+			return err
+		}
+	}
+	rs.result.SettingsRestored = true
+
+	return nil
+}
+
+// getUserDataSummary считает записи, которые хранятся о пользователе
+func (r *repository) getUserDataSummary(userID int64) (*userDataSummary, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM UserPairs WHERE user_id = $1),
+		       (SELECT COUNT(*) FROM Deals WHERE user_id = $1 AND sell_price IS NOT NULL),
+		       (SELECT COUNT(*) FROM Deals WHERE user_id = $1 AND sell_price IS NULL),
+		       (SELECT COUNT(*) FROM Deals WHERE user_id = $1 AND (note IS NOT NULL OR execution_rating IS NOT NULL OR emotion IS NOT NULL)),
+		       (SELECT COUNT(*) FROM DealAttachments AS a JOIN Deals AS d ON a.deal_id = d.deal_id WHERE d.user_id = $1),
+		       (SELECT COUNT(*) FROM DealRuleChecks AS c JOIN Deals AS d ON c.deal_id = d.deal_id WHERE d.user_id = $1),
+		       (SELECT COUNT(*) FROM LevelHits AS h JOIN Deals AS d ON h.deal_id = d.deal_id WHERE d.user_id = $1),
+		       (SELECT COUNT(*) FROM Tags WHERE user_id = $1),
+		       (SELECT COUNT(*) FROM Strategies WHERE user_id = $1),
+		       (SELECT COUNT(*) FROM StrategyRules AS sr JOIN Strategies AS s ON sr.strategy_id = s.strategy_id WHERE s.user_id = $1),
+		       (SELECT COUNT(*) FROM Accounts WHERE user_id = $1),
+		       (SELECT COUNT(*) FROM CashFlows AS f JOIN Accounts AS a ON f.account_id = a.account_id WHERE a.user_id = $1),
+		       (SELECT COUNT(*) FROM LimitBreaches WHERE user_id = $1),
+		       (SELECT COUNT(*) FROM ReportSchedules WHERE user_id = $1),
+		       (SELECT COUNT(*) FROM PriceAlerts WHERE user_id = $1)
+	`
+
+	var s userDataSummary
+	if err := r.conn.QueryRow(query, userID).Scan(&s.Pairs, &s.ClosedDeals, &s.OpenPositions, &s.Journals, &s.Attachments, &s.RuleChecks, &s.LevelHits,
+		&s.Tags, &s.Strategies, &s.Rules, &s.Accounts, &s.CashFlows, &s.Breaches, &s.Reports, &s.Alerts); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// deleteUser удаляет пользователя, остальные его записи удаляются каскадно
+func (r *repository) deleteUser(userID int64) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	// Сначала снимаем ссылку на текущий счет, чтобы удаление счетов не обновляло удаляемую строку пользователя
+	if _, err := tx.Exec("UPDATE Users SET current_account_id = NULL WHERE chat_id = $1", userID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM Users WHERE chat_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("user %v not found", userID)
+	}
+
+	return tx.Commit()
 }
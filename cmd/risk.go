@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных шагов стоп-лосса и тейк-профита
+const riskCallbackPrefix = "/risk:"
+
+// riskPerUnit возвращает риск на единицу актива: расстояние от цены покупки до стопа
+func (d *Deal) riskPerUnit() (decimal.Decimal, bool) {
+	if d.StopLoss.IsZero() {
+		return decimal.Zero, false
+	}
+
+	risk := d.BuyPrice.Sub(d.StopLoss)
+	if !risk.IsPositive() {
+		return decimal.Zero, false
+	}
+
+	return risk, true
+}
+
+// initialRisk возвращает сумму, которую трейдер был готов потерять по стопу
+func (d *Deal) initialRisk() (decimal.Decimal, bool) {
+	risk, ok := d.riskPerUnit()
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	return risk.Mul(d.Amount).Truncate(3), true
+}
+
+// rMultiple возвращает результат сделки в единицах начального риска
+func (d *Deal) rMultiple() (decimal.Decimal, bool) {
+	risk, ok := d.riskPerUnit()
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	return d.SellPrice.Sub(d.BuyPrice).Div(risk).Truncate(2), true
+}
+
+// plannedRewardRisk возвращает плановое соотношение прибыли к риску по тейку и стопу
+func (d *Deal) plannedRewardRisk() (decimal.Decimal, bool) {
+	risk, ok := d.riskPerUnit()
+	if !ok || d.TakeProfit.IsZero() {
+		return decimal.Zero, false
+	}
+
+	return d.TakeProfit.Sub(d.BuyPrice).Div(risk).Truncate(2), true
+}
+
+// formatRisk возвращает строки с уровнями и риском сделки, если они заданы
+func formatRisk(deal *Deal) string {
+	var sb strings.Builder
+	if !deal.StopLoss.IsZero() {
+		sb.WriteString("Стоп-лосс: " + deal.StopLoss.String() + "$\n")
+	}
+	if !deal.TakeProfit.IsZero() {
+		sb.WriteString("Тейк-профит: " + deal.TakeProfit.String() + "$\n")
+	}
+	if risk, ok := deal.initialRisk(); ok {
+		sb.WriteString("Риск: " + risk.String() + "$\n")
+	}
+	if r, ok := deal.rMultiple(); ok && !deal.Open {
+		sb.WriteString("Результат: " + r.String() + "R\n")
+	}
+	if rr, ok := deal.plannedRewardRisk(); ok {
+		sb.WriteString("План R:R: 1:" + rr.String() + "\n")
+	}
+
+	return sb.String()
+}
+
+func askStopLoss(ctx context.Context, b *bot.Bot, chatID int64) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Укажите стоп-лосс:",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Пропустить", CallbackData: riskCallbackPrefix + "skip_stop"}},
+		}},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingStopLoss
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingStopLoss)
+}
+
+func askTakeProfit(ctx context.Context, b *bot.Bot, chatID int64) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Укажите тейк-профит:",
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Пропустить", CallbackData: riskCallbackPrefix + "skip_take"}},
+		}},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingTakeProfit
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingTakeProfit)
+}
+
+func handleStopLoss(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil || usersPendingDeal[chatID] == nil {
+		return
+	}
+
+	stopLoss, err := validatePrice(update.Message.Text)
+	if err == nil && !stopLoss.LessThan(usersPendingDeal[chatID].BuyPrice) {
+		err = fmt.Errorf("стоп-лосс должен быть ниже цены покупки")
+	}
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	usersPendingDeal[chatID].StopLoss = stopLoss
+
+	askTakeProfit(ctx, b, chatID)
+}
+
+func handleTakeProfit(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil || usersPendingDeal[chatID] == nil {
+		return
+	}
+
+	takeProfit, err := validatePrice(update.Message.Text)
+	if err == nil && !takeProfit.GreaterThan(usersPendingDeal[chatID].BuyPrice) {
+		err = fmt.Errorf("тейк-профит должен быть выше цены покупки")
+	}
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+	usersPendingDeal[chatID].TakeProfit = takeProfit
+
+	askSellPrice(ctx, b, chatID)
+}
+
+func riskCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 || usersPendingDeal[chatID] == nil {
+		return
+	}
+
+	switch strings.TrimPrefix(update.CallbackQuery.Data, riskCallbackPrefix) {
+	case "skip_stop":
+		if usersStates[chatID] == StateAwaitingStopLoss {
+			askTakeProfit(ctx, b, chatID)
+		}
+	case "skip_take":
+		if usersStates[chatID] == StateAwaitingTakeProfit {
+			askSellPrice(ctx, b, chatID)
+		}
+	}
+}
+
+// rDistributionBuckets задает корзины распределения R по верхней границе, не входящей в корзину.
+// Первая корзина не ограничена снизу, последняя - сверху, поэтому ее граница не задана
+var rDistributionBuckets = []struct {
+	Label string
+	To    decimal.Decimal
+}{
+	{"< -1R", decimal.NewFromInt(-1)},
+	{"-1R…0R", decimal.Zero},
+	{"0R…1R", decimal.NewFromInt(1)},
+	{"1R…2R", decimal.NewFromInt(2)},
+	{"2R…3R", decimal.NewFromInt(3)},
+	{"≥ 3R", decimal.Zero},
+}
+
+// buildRStats возвращает блок статистики по R-мультипликаторам для сделок со стопом
+func buildRStats(deals []*Deal) string {
+	var total decimal.Decimal
+	var count int
+	buckets := make([]int, len(rDistributionBuckets))
+
+	for _, deal := range deals {
+		r, ok := deal.rMultiple()
+		if !ok {
+			continue
+		}
+
+		count++
+		total = total.Add(r)
+		for i, bucket := range rDistributionBuckets {
+			if i == len(rDistributionBuckets)-1 || r.LessThan(bucket.To) {
+				buckets[i]++
+				break
+			}
+		}
+	}
+
+	if count == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n<b>R-статистика</b> (" + fmt.Sprint(count) + " сделок со стопом):\n")
+	sb.WriteString("Всего: " + total.String() + "R\n")
+	sb.WriteString("Средний: " + total.Div(decimal.NewFromInt(int64(count))).Truncate(2).String() + "R\n")
+	for i, bucket := range rDistributionBuckets {
+		if buckets[i] > 0 {
+			sb.WriteString(fmt.Sprintf("%s: %d\n", html.EscapeString(bucket.Label), buckets[i]))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+
+	"playbook_bot/analytics"
+)
+
+func riskReportCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	text, err := buildRiskReport(chatID)
+	if err != nil {
+		log.Println("Error building risk report: ", err)
+		text = "Ошибка получения риск-метрик"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+// startingCapital - стартовый баланс текущего портфеля. Без счетов берем баланс из калькулятора /size
+func startingCapital(chatID int64, account *Account) (decimal.Decimal, error) {
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if len(accounts) == 0 {
+		user, err := Repository.getUser(chatID)
+		if err != nil || user == nil {
+			return decimal.Zero, err
+		}
+		return user.Balance, nil
+	}
+
+	var capital decimal.Decimal
+	for _, a := range accounts {
+		if account == nil || a.ID == account.ID {
+			capital = capital.Add(a.StartingBalance)
+		}
+	}
+
+	return capital, nil
+}
+
+// analyticsTrades переводит сделки в формат пакета analytics
+func analyticsTrades(deals []*Deal) []analytics.Trade {
+	trades := make([]analytics.Trade, 0, len(deals))
+	for _, deal := range deals {
+		trades = append(trades, analytics.Trade{Date: deal.Date, PnL: deal.Profit.InexactFloat64()})
+	}
+
+	return trades
+}
+
+// formatDuration выводит длительность в днях и часах, короткую - в часах и минутах
+func formatDuration(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days == 0 && hours == 0 {
+		return fmt.Sprintf("%d мин", minutes)
+	}
+	if days == 0 {
+		return fmt.Sprintf("%d ч %d мин", hours, minutes)
+	}
+
+	return fmt.Sprintf("%d д %d ч", days, hours)
+}
+
+func formatRatio(x float64) string {
+	return decimal.NewFromFloat(x).Round(2).String()
+}
+
+func buildRiskReport(chatID int64) (string, error) {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return "", err
+	}
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	if len(deals) == 0 {
+		return "кажется у вас еще нет сделок :(", nil
+	}
+
+	capital, err := startingCapital(chatID, account)
+	if err != nil {
+		return "", err
+	}
+	start := capital.InexactFloat64()
+
+	trades := analyticsTrades(deals)
+	drawdown := analytics.MaxDrawdown(start, trades)
+	loc := getUserLocation(chatID)
+	returns := analytics.DailyReturns(start, trades, loc)
+
+	var sb strings.Builder
+	sb.WriteString("<b>Риск-метрики 📉</b> (" + html.EscapeString(accountLabel(account)) + ")\n")
+	if capital.IsPositive() {
+		sb.WriteString("Стартовый капитал: " + capital.String() + "$\n")
+	} else {
+		sb.WriteString("<i>Стартовый капитал не задан: просадка в процентах недоступна, Шарп и Сортино считаются по дневному P&L. Создайте счет в /accounts.</i>\n")
+	}
+
+	sb.WriteString("\n<b>Макс. просадка:</b> " + formatRatio(drawdown.Amount) + "$")
+	if drawdown.Percent > 0 {
+		sb.WriteString(" (" + formatRatio(drawdown.Percent) + "%)")
+	}
+	sb.WriteString("\n")
+
+	if drawdown.Amount > 0 {
+		sb.WriteString("<b>С пика:</b> " + formatDate(drawdown.Peak, loc) + ", дно " + formatDate(drawdown.Trough, loc) + "\n")
+		if drawdown.Recovered() {
+			sb.WriteString("<b>Длительность просадки:</b> " + formatDuration(drawdown.Duration) + ", восстановлена " + formatDate(drawdown.Recovery, loc) + "\n")
+		} else {
+			sb.WriteString("<b>Длительность просадки:</b> " + formatDuration(drawdown.Duration) + ", еще не восстановлена\n")
+		}
+		sb.WriteString("<b>Фактор восстановления:</b> " + formatRatio(analytics.RecoveryFactor(start, trades)) + "\n")
+	}
+
+	if len(returns) < 2 {
+		sb.WriteString("\nДля Шарпа и Сортино нужно хотя бы два дня торговли")
+		return sb.String(), nil
+	}
+
+	sd := analytics.StdDev(returns)
+	if capital.IsPositive() {
+		sb.WriteString("\n<b>Ст. отклонение дневной доходности:</b> " + formatRatio(sd*100) + "%\n")
+	} else {
+		sb.WriteString("\n<b>Ст. отклонение дневного P&L:</b> " + formatRatio(sd) + "$\n")
+	}
+	sb.WriteString(fmt.Sprintf("<b>Шарп (годовой):</b> %s\n", formatRatio(analytics.Sharpe(returns))))
+	sb.WriteString(fmt.Sprintf("<b>Сортино (годовой):</b> %s\n", formatRatio(analytics.Sortino(returns))))
+	sb.WriteString(fmt.Sprintf("<i>По %d дням, годовые значения из расчета %d дней в году</i>", len(returns), analytics.PeriodsPerYear))
+
+	return sb.String(), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Как часто планировщик проверяет расписания отчетов
+const schedulerInterval = time.Minute
+
+// periodStart возвращает начало периода отчета, который заканчивается в end.
+// Период считается в часовом поясе loc, чтобы переход на летнее время и длина месяца
+// не сдвигали границы отчета.
+func periodStart(period ReportPeriod, end time.Time, loc *time.Location) time.Time {
+	local := end.In(loc)
+	switch period {
+	case ReportWeekly:
+		return local.AddDate(0, 0, -7).UTC()
+	case ReportMonthly:
+		return local.AddDate(0, -1, 0).UTC()
+	default:
+		return local.AddDate(0, 0, -1).UTC()
+	}
+}
+
+// nextReportRun считает ближайшее после after время отправки отчета в часовом поясе loc:
+// ежедневный - каждый день, еженедельный - по понедельникам, ежемесячный - 1 числа
+func nextReportRun(period ReportPeriod, hour int, loc *time.Location, after time.Time) time.Time {
+	local := after.In(loc)
+	y, m, d := local.Date()
+
+	var next time.Time
+	switch period {
+	case ReportWeekly:
+		daysToMonday := (int(time.Monday) - int(local.Weekday()) + 7) % 7
+		next = time.Date(y, m, d+daysToMonday, hour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+	case ReportMonthly:
+		next = time.Date(y, m, 1, hour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 1, 0)
+		}
+	default:
+		next = time.Date(y, m, d, hour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+
+	return next.UTC()
+}
+
+// runScheduler раз в минуту отправляет отчеты, время которых наступило, и завершается вместе с ctx.
+// Время следующей отправки хранится в базе, поэтому после перезапуска расписание продолжается,
+// а пропущенные за время простоя отчеты отправляются один раз.
+func runScheduler(ctx context.Context, b *bot.Bot) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		sendDueReports(ctx, b, time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Println("scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sendDueReports(ctx context.Context, b *bot.Bot, now time.Time) {
+	schedules, err := Repository.getDueReportSchedules(now)
+	if err != nil {
+		log.Println("Error getting report schedules: ", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+
+		loc := userLocation(schedule.Timezone)
+		end := schedule.NextRun
+
+		// Если отчет не собрался, все равно переходим к следующему запуску,
+		// иначе планировщик будет повторять ошибку каждую минуту
+		text, err := buildPeriodSummary(schedule.UserID, schedule.Period, periodStart(schedule.Period, end, loc), end, loc)
+		if err != nil {
+			log.Println("Error building report: ", err)
+		} else if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    schedule.UserID,
+			Text:      text,
+			ParseMode: models.ParseModeHTML,
+		}); err != nil {
+			log.Printf("can't send report to %v, error: %v", schedule.UserID, err)
+		}
+
+		// Следующий запуск считаем от текущего времени, чтобы не слать пропущенные отчеты пачкой
+		schedule.NextRun = nextReportRun(schedule.Period, schedule.Hour, loc, now)
+		if err := Repository.saveReportSchedule(schedule); err != nil {
+			log.Println("Error saving report schedule: ", err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// Префикс callback-данных калькулятора размера позиции
+const sizeCallbackPrefix = "/size:"
+
+// positionSize хранит введенные в калькулятор значения и результат расчета
+type positionSize struct {
+	Balance     decimal.Decimal
+	RiskPercent decimal.Decimal
+	Entry       decimal.Decimal
+	Stop        decimal.Decimal
+
+	RiskAmount decimal.Decimal
+	Size       decimal.Decimal
+}
+
+// Мапа расчетов калькулятора /size для пользователей
+var usersPendingSize = make(map[int64]*positionSize)
+
+// calculate считает сумму риска и размер позиции:
+// риск = баланс * процент риска / 100, размер = риск / (вход - стоп)
+func (p *positionSize) calculate() {
+	p.RiskAmount = p.Balance.Mul(p.RiskPercent).Div(decimal.NewFromInt(100)).Truncate(3)
+	p.Size = p.RiskAmount.Div(p.Entry.Sub(p.Stop)).Truncate(6)
+}
+
+func sizeCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	usersPendingSize[chatID] = &positionSize{}
+
+	params := &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Укажите баланс счета:",
+	}
+
+	user, err := Repository.getUser(chatID)
+	if err != nil {
+		log.Println("Error getting user: ", err)
+	}
+	if user != nil && user.Balance.IsPositive() {
+		params.ReplyMarkup = models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Использовать " + user.Balance.String() + "$", CallbackData: sizeCallbackPrefix + "stored_balance"}},
+		}}
+	}
+
+	if _, err := b.SendMessage(ctx, params); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingSizeBalance
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingSizeBalance)
+}
+
+func askSizeRisk(ctx context.Context, b *bot.Bot, chatID int64) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Сколько процентов баланса готовы потерять в сделке? (напр. 1)",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingSizeRisk
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingSizeRisk)
+}
+
+func handleSizeBalance(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	calc := usersPendingSize[chatID]
+	if chatID == 0 || update.Message == nil || calc == nil {
+		return
+	}
+
+	balance, err := validatePrice(update.Message.Text)
+	if err == nil && !balance.IsPositive() {
+		err = fmt.Errorf("баланс должен быть больше нуля")
+	}
+	if err != nil {
+		sendSizeError(ctx, b, chatID, err)
+		return
+	}
+	calc.Balance = balance
+
+	if err := Repository.setBalance(chatID, balance); err != nil {
+		log.Println("Error saving balance: ", err)
+	}
+
+	askSizeRisk(ctx, b, chatID)
+}
+
+func handleSizeRisk(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	calc := usersPendingSize[chatID]
+	if chatID == 0 || update.Message == nil || calc == nil {
+		return
+	}
+
+	risk, err := validatePrice(strings.TrimSuffix(strings.TrimSpace(update.Message.Text), "%"))
+	if err == nil && (!risk.IsPositive() || risk.GreaterThan(decimal.NewFromInt(100))) {
+		err = fmt.Errorf("процент риска должен быть больше 0 и не больше 100")
+	}
+	if err != nil {
+		sendSizeError(ctx, b, chatID, err)
+		return
+	}
+	calc.RiskPercent = risk
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Укажите цену входа:",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingSizeEntry
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingSizeEntry)
+}
+
+func handleSizeEntry(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	calc := usersPendingSize[chatID]
+	if chatID == 0 || update.Message == nil || calc == nil {
+		return
+	}
+
+	entry, err := validatePrice(update.Message.Text)
+	if err == nil && !entry.IsPositive() {
+		err = fmt.Errorf("цена входа должна быть больше нуля")
+	}
+	if err != nil {
+		sendSizeError(ctx, b, chatID, err)
+		return
+	}
+	calc.Entry = entry
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Укажите цену стоп-лосса:",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingSizeStop
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingSizeStop)
+}
+
+func handleSizeStop(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	calc := usersPendingSize[chatID]
+	if chatID == 0 || update.Message == nil || calc == nil {
+		return
+	}
+
+	stop, err := validatePrice(update.Message.Text)
+	if err == nil && !stop.LessThan(calc.Entry) {
+		err = fmt.Errorf("стоп-лосс должен быть ниже цены входа")
+	}
+	if err != nil {
+		sendSizeError(ctx, b, chatID, err)
+		return
+	}
+	calc.Stop = stop
+	calc.calculate()
+
+	usersStates[chatID] = StateIdle
+
+	text := "<b>Расчет позиции 🧮</b>\n" +
+		"<b>Баланс:</b> " + calc.Balance.String() + "$\n" +
+		"<b>Риск:</b> " + calc.RiskPercent.String() + "% = " + calc.RiskAmount.String() + "$\n" +
+		"<b>Вход:</b> " + calc.Entry.String() + "\n" +
+		"<b>Стоп:</b> " + calc.Stop.String() + "\n" +
+		"<b>Размер позиции:</b> " + calc.Size.String() + "\n" +
+		"<b>Объем позиции:</b> " + calc.Size.Mul(calc.Entry).Truncate(3).String() + "$\n"
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Открыть позицию", CallbackData: sizeCallbackPrefix + "open"}},
+		}},
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+func sizeCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		return
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		ShowAlert:       false,
+	}); err != nil {
+		log.Println("error answering callback ", getChatID(update), err)
+	}
+
+	chatID := getChatID(update)
+	calc := usersPendingSize[chatID]
+	if chatID == 0 || calc == nil {
+		return
+	}
+
+	switch strings.TrimPrefix(update.CallbackQuery.Data, sizeCallbackPrefix) {
+	case "stored_balance":
+		user, err := Repository.getUser(chatID)
+		if err != nil || user == nil || !user.Balance.IsPositive() {
+			log.Println("Error getting user balance: ", err)
+			return
+		}
+		calc.Balance = user.Balance
+
+		askSizeRisk(ctx, b, chatID)
+	case "open":
+		if calc.Size.IsZero() {
+			return
+		}
+
+		// Сделка заполнена расчетом, останется выбрать пару и стратегию
+		usersPendingDeal[chatID] = &Deal{
+			Amount:   calc.Size,
+			BuyPrice: calc.Entry,
+			StopLoss: calc.Stop,
+		}
+		delete(usersPendingSize, chatID)
+
+		askDealPair(ctx, b, chatID)
+	}
+}
+
+func sendSizeError(ctx context.Context, b *bot.Bot, chatID int64, err error) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   err.Error(),
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
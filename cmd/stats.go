@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+)
+
+// dealGroupStats накапливает результат группы сделок
+type dealGroupStats struct {
+	Count int
+	Wins  int
+	PnL   decimal.Decimal
+}
+
+func (s *dealGroupStats) add(deal *Deal) {
+	s.Count++
+	s.PnL = s.PnL.Add(deal.Profit)
+	if deal.Profit.IsPositive() {
+		s.Wins++
+	}
+}
+
+// merge добавляет к группе результаты другой группы
+func (s *dealGroupStats) merge(other dealGroupStats) {
+	s.Count += other.Count
+	s.Wins += other.Wins
+	s.PnL = s.PnL.Add(other.PnL)
+}
+
+func (s *dealGroupStats) winRate() decimal.Decimal {
+	if s.Count == 0 {
+		return decimal.Zero
+	}
+
+	return decimal.NewFromInt(int64(s.Wins)).Div(decimal.NewFromInt(int64(s.Count))).Mul(decimal.NewFromInt(100)).Truncate(1)
+}
+
+func (s *dealGroupStats) String() string {
+	return fmt.Sprintf("%d сделок, P&L %s$, винрейт %s%%", s.Count, s.PnL.Truncate(3).String(), s.winRate().String())
+}
+
+func statsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	text, err := buildStatsText(chatID)
+	if err != nil {
+		log.Println("Error building stats: ", err)
+		text = "Ошибка получения статистики"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "Отчет по тегам", CallbackData: "/tags"}, {Text: "Лимиты", CallbackData: "/limits"}},
+			{{Text: "Риск-метрики", CallbackData: "/risk_report"}, {Text: "Удержание", CallbackData: "/holding"}},
+			{{Text: "Тепловая карта", CallbackData: "/heatmap"}, {Text: "Календарь", CallbackData: "/calendar"}},
+		}},
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func buildStatsText(chatID int64) (string, error) {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	if len(deals) == 0 {
+		return "кажется у вас еще нет сделок :(", nil
+	}
+
+	checks, err := Repository.getDealRuleChecks(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	strategies, err := Repository.getStrategies(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	var total dealGroupStats
+	byStrategy := make(map[int64]*dealGroupStats)
+	var followedAll, brokeRules dealGroupStats
+	ruleFollowed := make(map[int64]*dealGroupStats)
+	ruleBroken := make(map[int64]*dealGroupStats)
+
+	for _, deal := range deals {
+		total.add(deal)
+
+		if byStrategy[deal.StrategyID] == nil {
+			byStrategy[deal.StrategyID] = &dealGroupStats{}
+		}
+		byStrategy[deal.StrategyID].add(deal)
+
+		dealChecks := checks[deal.ID]
+		if len(dealChecks) == 0 {
+			continue
+		}
+
+		broken := false
+		for ruleID, followed := range dealChecks {
+			group := ruleFollowed
+			if !followed {
+				group = ruleBroken
+				broken = true
+			}
+			if group[ruleID] == nil {
+				group[ruleID] = &dealGroupStats{}
+			}
+			group[ruleID].add(deal)
+		}
+
+		if broken {
+			brokeRules.add(deal)
+		} else {
+			followedAll.add(deal)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Статистика 📊</b> (" + html.EscapeString(accountLabel(account)) + ")\n")
+	sb.WriteString("Всего: " + total.String() + "\n")
+	if holding, ok := averageHolding(deals); ok {
+		sb.WriteString("Среднее удержание: " + formatDuration(holding) + "\n")
+	}
+	sb.WriteString(buildRStats(deals))
+
+	summaries, err := getAccountSummaries(chatID)
+	if err != nil {
+		return "", err
+	}
+	if account != nil {
+		summaries = filterAccountSummaries(summaries, account.ID)
+	}
+	if len(summaries) > 0 {
+		sb.WriteString("\n<b>Счета:</b>\n")
+		sb.WriteString(buildAccountsText(summaries))
+	}
+
+	sb.WriteString("\n<b>По стратегиям:</b>\n")
+	for _, strategy := range strategies {
+		if s := byStrategy[strategy.ID]; s != nil {
+			sb.WriteString(html.EscapeString(strategy.Name) + ": " + s.String() + "\n")
+		}
+	}
+	if s := byStrategy[0]; s != nil {
+		sb.WriteString("Без стратегии: " + s.String() + "\n")
+	}
+
+	breaches, err := buildBreachStats(chatID)
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString(breaches)
+
+	if followedAll.Count+brokeRules.Count > 0 {
+		sb.WriteString("\n<b>Соблюдение правил:</b>\n")
+		sb.WriteString("Все правила соблюдены: " + followedAll.String() + "\n")
+		sb.WriteString("Правила нарушены: " + brokeRules.String() + "\n")
+
+		for _, strategy := range strategies {
+			rules, err := Repository.getStrategyRules(strategy.ID)
+			if err != nil {
+				return "", err
+			}
+
+			for _, rule := range rules {
+				followed, broken := ruleFollowed[rule.ID], ruleBroken[rule.ID]
+				if followed == nil && broken == nil {
+					continue
+				}
+
+				sb.WriteString("\n<i>" + html.EscapeString(strategy.Name) + " — " + html.EscapeString(rule.Text) + "</i>\n")
+				if followed != nil {
+					sb.WriteString("соблюдено: " + followed.String() + "\n")
+				}
+				if broken != nil {
+					sb.WriteString("нарушено: " + broken.String() + "\n")
+				}
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// filterAccountDeals оставляет сделки одного портфеля
+func filterAccountDeals(deals []*Deal, accountID int64) []*Deal {
+	var filtered []*Deal
+	for _, deal := range deals {
+		if deal.AccountID == accountID {
+			filtered = append(filtered, deal)
+		}
+	}
+
+	return filtered
+}
+
+func filterAccountSummaries(summaries []*accountSummary, accountID int64) []*accountSummary {
+	var filtered []*accountSummary
+	for _, summary := range summaries {
+		if summary.Account.ID == accountID {
+			filtered = append(filtered, summary)
+		}
+	}
+
+	return filtered
+}
+
+// averageHolding - среднее время удержания по сделкам с указанной датой входа
+func averageHolding(deals []*Deal) (time.Duration, bool) {
+	var total time.Duration
+	var count int
+	for _, deal := range deals {
+		if holding, ok := deal.holdingTime(); ok {
+			total += holding
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+
+	return total / time.Duration(count), true
+}
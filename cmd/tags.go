@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"html"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Сколько недавних тегов показывать кнопками
+const maxTagButtons = 8
+
+var hashtagRegexp = regexp.MustCompile(`#[\p{L}\p{N}_]+`)
+
+// parseHashtags достает из текста уникальные хештеги без решетки в нижнем регистре
+func parseHashtags(text string) []string {
+	var tags []string
+	for _, match := range hashtagRegexp.FindAllString(text, -1) {
+		tag := strings.ToLower(strings.TrimPrefix(match, "#"))
+		if len([]rune(tag)) > 30 || slices.Contains(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func formatTags(tags []string) string {
+	return "#" + strings.Join(tags, " #")
+}
+
+func buildTagChecklist(tags []*Tag, selected []string) *models.InlineKeyboardMarkup {
+	var keyboard [][]models.InlineKeyboardButton
+	for i := 0; i < len(tags); i += 2 {
+		var row []models.InlineKeyboardButton
+		for _, tag := range tags[i:min(i+2, len(tags))] {
+			text := "#" + tag.Name
+			if slices.Contains(selected, tag.Name) {
+				text = "✅ " + text
+			}
+			row = append(row, models.InlineKeyboardButton{Text: text, CallbackData: journalCallbackPrefix + "tag:" + strconv.FormatInt(tag.ID, 10)})
+		}
+		keyboard = append(keyboard, row)
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: "Готово", CallbackData: journalCallbackPrefix + "tags_done"}})
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// askJournalTags предлагает отметить недавние теги. Новые теги пользователь пишет в заметке через #.
+func askJournalTags(ctx context.Context, b *bot.Bot, chatID int64) {
+	deal := usersPendingJournal[chatID]
+	if deal == nil {
+		return
+	}
+
+	tags, err := Repository.getTags(chatID, maxTagButtons)
+	if err != nil {
+		log.Println("Error getting tags: ", err)
+	}
+
+	if len(tags) == 0 {
+		finishJournal(ctx, b, chatID)
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Отметьте теги сделки. Новые теги можно писать в заметке через #, напр. #scalp",
+		ReplyMarkup: buildTagChecklist(tags, deal.Tags),
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+}
+
+// toggleJournalTag добавляет или убирает тег у сделки и обновляет кнопки
+func toggleJournalTag(ctx context.Context, b *bot.Bot, update *models.Update, deal *Deal, tagID int64) {
+	chatID := getChatID(update)
+
+	tag, err := Repository.getTag(chatID, tagID)
+	if err != nil || tag == nil {
+		log.Println("Error getting tag: ", err)
+		return
+	}
+
+	if i := slices.Index(deal.Tags, tag.Name); i >= 0 {
+		deal.Tags = slices.Delete(deal.Tags, i, i+1)
+	} else {
+		deal.Tags = append(deal.Tags, tag.Name)
+	}
+
+	tags, err := Repository.getTags(chatID, maxTagButtons)
+	if err != nil {
+		log.Println("Error getting tags: ", err)
+		return
+	}
+
+	if update.CallbackQuery.Message.Message == nil {
+		return
+	}
+
+	if _, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      chatID,
+		MessageID:   update.CallbackQuery.Message.Message.ID,
+		ReplyMarkup: buildTagChecklist(tags, deal.Tags),
+	}); err != nil {
+		log.Printf("can't edit message for %v, error: %v", chatID, err)
+	}
+}
+
+func tagsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	text, err := buildTagReport(chatID)
+	if err != nil {
+		log.Println("Error building tag report: ", err)
+		text = "Ошибка получения отчета по тегам"
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
+
+func buildTagReport(chatID int64) (string, error) {
+	account, err := currentAccount(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		return "", err
+	}
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	byTag := make(map[string]*dealGroupStats)
+	for _, deal := range deals {
+		for _, tag := range deal.Tags {
+			if byTag[tag] == nil {
+				byTag[tag] = &dealGroupStats{}
+			}
+			byTag[tag].add(deal)
+		}
+	}
+
+	if len(byTag) == 0 {
+		return "У ваших сделок пока нет тегов. Добавляйте их в заметке журнала через #, напр. #scalp", nil
+	}
+
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if byTag[tags[i]].Count != byTag[tags[j]].Count {
+			return byTag[tags[i]].Count > byTag[tags[j]].Count
+		}
+		return tags[i] < tags[j]
+	})
+
+	var sb strings.Builder
+	sb.WriteString("<b>Отчет по тегам 🏷</b> (" + html.EscapeString(accountLabel(account)) + ")\n")
+	for _, tag := range tags {
+		sb.WriteString("#" + tag + ": " + byTag[tag].String() + "\n")
+	}
+
+	return sb.String(), nil
+}
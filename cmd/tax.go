@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/shopspring/decimal"
+
+	"playbook_bot/lots"
+)
+
+const taxUsage = "Пример: /tax 2024 или /tax 2024 avg для расчета по средней цене"
+
+var taxMethodNames = map[lots.Method]string{
+	lots.FIFO:        "FIFO",
+	lots.AverageCost: "по средней цене",
+}
+
+// dealFills раскладывает сделки на исполнения: покупку в момент входа и продажу в момент выхода.
+// У старых сделок без даты входа покупка считается совершенной в момент выхода
+func dealFills(deals []*Deal) []lots.Fill {
+	fills := make([]lots.Fill, 0, 2*len(deals))
+	for _, deal := range deals {
+		instrument := normalizePair(deal.Pair)
+		currency := quoteCurrency(deal.Pair)
+
+		bought := deal.Date
+		if !deal.EntryDate.IsZero() {
+			bought = deal.EntryDate
+		}
+		fills = append(fills, lots.Fill{Instrument: instrument, Currency: currency, Side: lots.Buy, Quantity: deal.Amount, Price: deal.BuyPrice, Date: bought})
+
+		if !deal.Open {
+			fills = append(fills, lots.Fill{Instrument: instrument, Currency: currency, Side: lots.Sell, Quantity: deal.Amount, Price: deal.SellPrice, Date: deal.Date})
+		}
+	}
+
+	return fills
+}
+
+// yearRealizations сопоставляет всю историю сделок и оставляет продажи, совершенные в году year
+func yearRealizations(deals []*Deal, year int, method lots.Method, loc *time.Location) ([]lots.Realization, error) {
+	realized, _, err := lots.Match(dealFills(deals), method)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []lots.Realization
+	for _, r := range realized {
+		if r.Disposed.In(loc).Year() == year {
+			result = append(result, r)
+		}
+	}
+
+	return result, nil
+}
+
+// dealsWithoutAmount считает закрытые в году year сделки без количества. Это сделки, сохраненные
+// до появления поля количества: сопоставить их лоты нельзя, и в отчет они не попадают
+func dealsWithoutAmount(deals []*Deal, year int, loc *time.Location) int {
+	var count int
+	for _, deal := range deals {
+		if !deal.Open && !deal.Amount.IsPositive() && deal.Date.In(loc).Year() == year {
+			count++
+		}
+	}
+
+	return count
+}
+
+func buildTaxText(summaries []lots.Summary, year int, method lots.Method, account *Account, skipped int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<b>Налоговый отчет за %d 🧾</b> (%s, %s)\n\n", year, html.EscapeString(accountLabel(account)), taxMethodNames[method]))
+
+	// Без этого предупреждения итог выглядел бы полным, хотя часть продаж в него не вошла
+	var note string
+	if skipped > 0 {
+		note = "\n<i>Не учтено сделок без количества: " + strconv.Itoa(skipped) + ". Их прибыль нужно посчитать отдельно</i>"
+	}
+
+	if len(summaries) == 0 {
+		if skipped > 0 {
+			sb.WriteString("За этот год нет продаж с указанным количеством")
+		} else {
+			sb.WriteString("За этот год продаж не было")
+		}
+		sb.WriteString(note)
+		return sb.String()
+	}
+
+	totals := make(map[string]decimal.Decimal)
+	for _, s := range summaries {
+		sb.WriteString(fmt.Sprintf("<b>%s</b>: продано %s, выручка %s, затраты %s, результат %s %s\n",
+			html.EscapeString(s.Instrument), s.Quantity.String(), s.Proceeds.Truncate(2).String(), s.Cost.Truncate(2).String(), s.Gain.Truncate(2).String(), html.EscapeString(s.Currency)))
+		totals[s.Currency] = totals[s.Currency].Add(s.Gain)
+	}
+
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	sb.WriteString("\n<b>Итого реализовано:</b>\n")
+	for _, currency := range currencies {
+		sb.WriteString(totals[currency].Truncate(2).String() + " " + html.EscapeString(currency) + "\n")
+	}
+	sb.WriteString(note)
+
+	return sb.String()
+}
+
+// buildTaxCSV выгружает каждое списание лота отдельной строкой
+func buildTaxCSV(realized []lots.Realization, loc *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write([]string{"instrument", "currency", "quantity", "acquired", "disposed", "proceeds", "cost", "gain"}); err != nil {
+		return nil, err
+	}
+
+	for _, r := range realized {
+		var acquired string
+		if !r.Acquired.IsZero() {
+			acquired = formatDate(r.Acquired, loc)
+		}
+
+		record := []string{r.Instrument, r.Currency, r.Quantity.String(), acquired, formatDate(r.Disposed, loc),
+			r.Proceeds.String(), r.Cost.String(), r.Gain().String()}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseTaxArgs разбирает аргументы /tax: год и способ списания, без года берется текущий
+func parseTaxArgs(args []string, now time.Time) (int, lots.Method, error) {
+	year := now.Year()
+	method := lots.FIFO
+
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "fifo":
+			method = lots.FIFO
+		case "avg", "average", "средняя":
+			method = lots.AverageCost
+		default:
+			y, err := strconv.Atoi(arg)
+			if err != nil || y < 2000 || y > now.Year() {
+				return 0, 0, fmt.Errorf("не понял год %q. %s", arg, taxUsage)
+			}
+			year = y
+		}
+	}
+
+	return year, method, nil
+}
+
+func taxCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	fields := strings.Fields(update.Message.Text)
+	if len(fields) == 0 || fields[0] != "/tax" {
+		return
+	}
+
+	loc := getUserLocation(chatID)
+	year, method, err := parseTaxArgs(fields[1:], time.Now().In(loc))
+	if err != nil {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   err.Error(),
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	account, err := currentAccount(chatID)
+	if err != nil {
+		log.Println("Error getting current account: ", err)
+		return
+	}
+
+	deals, err := Repository.getDeals(chatID)
+	if err != nil {
+		log.Println("Error getting deals: ", err)
+		return
+	}
+
+	// Покупки открытых позиций тоже лоты: по FIFO они списываются раньше более поздних покупок
+	positions, err := Repository.getOpenPositions(chatID)
+	if err != nil {
+		log.Println("Error getting open positions: ", err)
+		return
+	}
+	deals = append(deals, positions...)
+	if account != nil {
+		deals = filterAccountDeals(deals, account.ID)
+	}
+
+	realized, err := yearRealizations(deals, year, method, loc)
+	if err != nil {
+		log.Println("Error matching lots: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Не удалось сопоставить покупки и продажи: в истории продано больше, чем куплено",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      buildTaxText(lots.Summarize(realized), year, method, account, dealsWithoutAmount(deals, year, loc)),
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+
+	if len(realized) == 0 {
+		return
+	}
+
+	data, err := buildTaxCSV(realized, loc)
+	if err != nil {
+		log.Println("Error building tax csv: ", err)
+		return
+	}
+
+	if _, err := b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: fmt.Sprintf("tax_%d.csv", year), Data: bytes.NewReader(data)},
+		Caption:  "Продажи за " + strconv.Itoa(year) + " с сопоставленными покупками",
+	}); err != nil {
+		log.Printf("can't send document to %v, error: %v", chatID, err)
+	}
+}
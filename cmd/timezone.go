@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Все даты хранятся в базе в UTC и показываются пользователю в его часовом поясе
+const (
+	dateLayout     = "02-01-2006"
+	dateTimeLayout = "02-01-2006 15:04"
+)
+
+// userLocation возвращает часовой пояс по имени IANA, по умолчанию UTC
+func userLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Println("invalid timezone ", timezone, err)
+		return time.UTC
+	}
+
+	return loc
+}
+
+// getUserLocation загружает часовой пояс пользователя из базы
+func getUserLocation(chatID int64) *time.Location {
+	user, err := Repository.getUser(chatID)
+	if err != nil || user == nil {
+		if err != nil {
+			log.Println("Error getting user: ", err)
+		}
+		return time.UTC
+	}
+
+	return userLocation(user.Timezone)
+}
+
+func formatDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(dateLayout)
+}
+
+func formatDateTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(dateTimeLayout)
+}
+
+func timezoneCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	askTimezone(ctx, b, chatID)
+}
+
+func askTimezone(ctx context.Context, b *bot.Bot, chatID int64) {
+	loc := getUserLocation(chatID)
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Текущий часовой пояс: " + loc.String() + ", у вас сейчас " + time.Now().In(loc).Format("15:04") + ".\nВведите новый часовой пояс, например Europe/Moscow или Asia/Almaty:",
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+		return
+	}
+
+	usersStates[chatID] = StateAwaitingTimezone
+	log.Printf("update user %v state for %v  ", chatID, StateAwaitingTimezone)
+}
+
+func handleTimezone(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := getChatID(update)
+	if chatID == 0 || update.Message == nil {
+		return
+	}
+
+	timezone := strings.TrimSpace(update.Message.Text)
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" || timezone == "Local" {
+		sendReportsError(ctx, b, chatID, fmt.Errorf("неизвестный часовой пояс, пример: Europe/Moscow"))
+		return
+	}
+
+	if err := Repository.setTimezone(chatID, loc.String()); err != nil {
+		log.Println("Error saving timezone: ", err)
+		return
+	}
+
+	// Расписание отчетов привязано к местному времени, пересчитываем его
+	schedules, err := Repository.getReportSchedules(chatID)
+	if err != nil {
+		log.Println("Error getting report schedules: ", err)
+		return
+	}
+	if err := rescheduleReports(chatID, reportHour(schedules), loc.String()); err != nil {
+		log.Println("Error saving report schedule: ", err)
+		return
+	}
+
+	usersStates[chatID] = StateIdle
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Часовой пояс " + loc.String() + " сохранен ✅ У вас сейчас " + time.Now().In(loc).Format("15:04"),
+	}); err != nil {
+		log.Println("error sending msg ", chatID, err)
+	}
+
+	if err := showStandardButtons(ctx, b, update); err != nil {
+		log.Printf("can't send message to %v, error: %v", chatID, err)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// Листы выгрузки. Summary ссылается на Trades формулами, поэтому имена лучше не менять
+const (
+	xlsxTradesSheet  = "Trades"
+	xlsxSummarySheet = "Summary"
+	xlsxPairsSheet   = "Per-Pair"
+)
+
+var xlsxTradesHeader = []any{"Дата", "Пара", "Статус", "Количество", "Покупка", "Продажа", "Прибыль", "Прибыль, %", "Вход", "Стоп-лосс", "Тейк-профит", "Сетап", "Теги", "Заметка"}
+
+// Итоги на листе Summary: подпись, формула по листу Trades и формат числа.
+// Столбец C листа Trades - статус, G - прибыль
+var xlsxSummaryRows = []struct {
+	Title   string
+	Formula string
+	Format  string
+}{
+	{"Закрытых сделок", `COUNTIF(Trades!C:C,"закрыта")`, "0"},
+	{"Открытых позиций", `COUNTIF(Trades!C:C,"открыта")`, "0"},
+	{"Прибыльных сделок", `COUNTIF(Trades!G:G,">0")`, "0"},
+	{"Винрейт", "IF(B2=0,0,B4/B2)", "0.0%"},
+	{"Общий P&L", "SUM(Trades!G:G)", "0.00"},
+	{"Средний результат", "IF(B2=0,0,B6/B2)", "0.00"},
+	{"Лучшая сделка", "MAX(Trades!G:G)", "0.00"},
+	{"Худшая сделка", "MIN(Trades!G:G)", "0.00"},
+	{"Профит-фактор", `IFERROR(SUMIF(Trades!G:G,">0")/-SUMIF(Trades!G:G,"<0"),0)`, "0.00"},
+}
+
+// excelTime переносит время в часовой пояс пользователя: в Excel у дат нет часового пояса
+func excelTime(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func xlsxStyle(f *excelize.File, format string, bold bool) (int, error) {
+	style := &excelize.Style{CustomNumFmt: &format}
+	if format == "" {
+		style.CustomNumFmt = nil
+	}
+	if bold {
+		style.Font = &excelize.Font{Bold: true}
+	}
+
+	return f.NewStyle(style)
+}
+
+func writeTradesSheet(f *excelize.File, deals []*Deal, loc *time.Location) error {
+	if err := f.SetSheetRow(xlsxTradesSheet, "A1", &xlsxTradesHeader); err != nil {
+		return err
+	}
+
+	for i, deal := range deals {
+		status := "закрыта"
+		var sellPrice, profit, profitPercent any
+		if deal.Open {
+			status = "открыта"
+		} else {
+			sellPrice = deal.SellPrice.InexactFloat64()
+			profit = deal.Profit.InexactFloat64()
+			profitPercent = deal.ProfitPercent.InexactFloat64()
+		}
+
+		var entry, stopLoss, takeProfit any
+		if !deal.EntryDate.IsZero() {
+			entry = excelTime(deal.EntryDate, loc)
+		}
+		if !deal.StopLoss.IsZero() {
+			stopLoss = deal.StopLoss.InexactFloat64()
+		}
+		if !deal.TakeProfit.IsZero() {
+			takeProfit = deal.TakeProfit.InexactFloat64()
+		}
+
+		row := []any{excelTime(deal.Date, loc), deal.Pair, status, deal.Amount.InexactFloat64(), deal.BuyPrice.InexactFloat64(),
+			sellPrice, profit, profitPercent, entry, stopLoss, takeProfit, deal.Strategy, formatTags(deal.Tags), deal.Note}
+
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(xlsxTradesSheet, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	dateStyle, err := xlsxStyle(f, "dd.mm.yyyy hh:mm", false)
+	if err != nil {
+		return err
+	}
+	headerStyle, err := xlsxStyle(f, "", true)
+	if err != nil {
+		return err
+	}
+
+	last := len(deals) + 1
+	for _, col := range []string{"A", "I"} {
+		if err := f.SetCellStyle(xlsxTradesSheet, col+"2", col+strconv.Itoa(last), dateStyle); err != nil {
+			return err
+		}
+	}
+	if err := f.SetRowStyle(xlsxTradesSheet, 1, 1, headerStyle); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(xlsxTradesSheet, "A", "A", 17); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(xlsxTradesSheet, "I", "I", 17); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(xlsxTradesSheet, "N", "N", 40); err != nil {
+		return err
+	}
+
+	if err := f.AutoFilter(xlsxTradesSheet, "A1:N"+strconv.Itoa(last), nil); err != nil {
+		return err
+	}
+
+	return f.SetPanes(xlsxTradesSheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+}
+
+func writeSummarySheet(f *excelize.File, title string) error {
+	headerStyle, err := xlsxStyle(f, "", true)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range xlsxSummaryRows {
+		n := strconv.Itoa(i + 2)
+		if err := f.SetCellValue(xlsxSummarySheet, "A"+n, row.Title); err != nil {
+			return err
+		}
+		if err := f.SetCellFormula(xlsxSummarySheet, "B"+n, row.Formula); err != nil {
+			return err
+		}
+
+		style, err := xlsxStyle(f, row.Format, false)
+		if err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(xlsxSummarySheet, "B"+n, "B"+n, style); err != nil {
+			return err
+		}
+	}
+
+	if err := f.SetCellValue(xlsxSummarySheet, "A1", title); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(xlsxSummarySheet, "A1", "A1", headerStyle); err != nil {
+		return err
+	}
+
+	return f.SetColWidth(xlsxSummarySheet, "A", "A", 24)
+}
+
+func writePairsSheet(f *excelize.File, deals []*Deal) error {
+	byPair := make(map[string]*dealGroupStats)
+	for _, deal := range deals {
+		if deal.Open {
+			continue
+		}
+		if byPair[deal.Pair] == nil {
+			byPair[deal.Pair] = &dealGroupStats{}
+		}
+		byPair[deal.Pair].add(deal)
+	}
+
+	pairs := make([]string, 0, len(byPair))
+	for pair := range byPair {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	header := []any{"Пара", "Сделок", "Прибыльных", "Винрейт, %", "P&L"}
+	if err := f.SetSheetRow(xlsxPairsSheet, "A1", &header); err != nil {
+		return err
+	}
+
+	for i, pair := range pairs {
+		stats := byPair[pair]
+		row := []any{pair, stats.Count, stats.Wins, stats.winRate().InexactFloat64(), stats.PnL.InexactFloat64()}
+		if err := f.SetSheetRow(xlsxPairsSheet, "A"+strconv.Itoa(i+2), &row); err != nil {
+			return err
+		}
+	}
+
+	headerStyle, err := xlsxStyle(f, "", true)
+	if err != nil {
+		return err
+	}
+
+	return f.SetRowStyle(xlsxPairsSheet, 1, 1, headerStyle)
+}
+
+// buildDealsXLSX собирает книгу из листов Trades, Summary и Per-Pair
+func buildDealsXLSX(deals []*Deal, title string, loc *time.Location) ([]byte, error) {
+	f := excelize.NewFile()
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println("Error closing xlsx: ", err)
+		}
+	}()
+
+	if err := f.SetSheetName("Sheet1", xlsxTradesSheet); err != nil {
+		return nil, err
+	}
+	if _, err := f.NewSheet(xlsxSummarySheet); err != nil {
+		return nil, err
+	}
+	if _, err := f.NewSheet(xlsxPairsSheet); err != nil {
+		return nil, err
+	}
+
+	if err := writeTradesSheet(f, deals, loc); err != nil {
+		return nil, err
+	}
+	if err := writeSummarySheet(f, title); err != nil {
+		return nil, err
+	}
+	if err := writePairsSheet(f, deals); err != nil {
+		return nil, err
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sendDealsXLSX выгружает сделки с тем же фильтром, что и в истории
+func sendDealsXLSX(ctx context.Context, b *bot.Bot, chatID int64, filter dealFilter) {
+	deals, err := Repository.getFilteredDeals(chatID, filter)
+	if err != nil {
+		log.Println("Error getting deals: ", err)
+		return
+	}
+
+	if len(deals) == 0 {
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "кажется у вас еще нет сделок :(",
+		}); err != nil {
+			log.Printf("can't send message to %v, error: %v", chatID, err)
+		}
+		return
+	}
+
+	accounts, err := Repository.getAccounts(chatID)
+	if err != nil {
+		log.Println("Error getting accounts: ", err)
+		return
+	}
+
+	var account *Account
+	for _, a := range accounts {
+		if a.ID == filter.AccountID {
+			account = a
+		}
+	}
+
+	title := accountLabel(account)
+	if filter.TagID != 0 {
+		tag, err := Repository.getTag(chatID, filter.TagID)
+		if err != nil {
+			log.Println("Error getting tag: ", err)
+			return
+		}
+		if tag != nil {
+			title += ", #" + tag.Name
+		}
+	}
+
+	data, err := buildDealsXLSX(deals, title, getUserLocation(chatID))
+	if err != nil {
+		log.Println("Error building xlsx: ", err)
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Не удалось собрать выгрузку",
+		}); err != nil {
+			log.Println("error sending msg ", chatID, err)
+		}
+		return
+	}
+
+	if _, err := b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: "deals.xlsx", Data: bytes.NewReader(data)},
+		Caption:  "Выгрузка сделок: " + title,
+	}); err != nil {
+		log.Printf("can't send document to %v, error: %v", chatID, err)
+	}
+}
+
+// exportCommand выгружает сделки с последним фильтром истории или, если историю
+// еще не открывали, сделки текущего портфеля
+func exportCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		}); err != nil {
+			log.Println("error answering callback ", getChatID(update), err)
+		}
+	}
+
+	chatID := getChatID(update)
+	if chatID == 0 {
+		return
+	}
+
+	filter, ok := usersHistoryFilter[chatID]
+	if !ok {
+		filter = dealFilter{AccountID: currentAccountID(chatID)}
+	}
+
+	sendDealsXLSX(ctx, b, chatID, filter)
+}
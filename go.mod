@@ -3,9 +3,21 @@ module playbook_bot
 go 1.22
 
 require (
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/go-telegram/bot v1.1.5
 	github.com/lib/pq v1.10.9
 	github.com/shopspring/decimal v1.3.1
+	github.com/xuri/excelize/v2 v2.9.0
+	golang.org/x/image v0.18.0
 )
 
-require github.com/go-telegram/ui v0.3.1 // indirect
+require (
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	github.com/richardlehane/mscfb v1.0.4 // indirect
+	github.com/richardlehane/msoleps v1.0.4 // indirect
+	github.com/xuri/efp v0.0.0-20240408161823-9ad904a10d6d // indirect
+	github.com/xuri/nfp v0.0.0-20240318013403-ab9948c2c4a7 // indirect
+	golang.org/x/crypto v0.28.0 // indirect
+	golang.org/x/net v0.30.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+)
@@ -0,0 +1,253 @@
+// Package lots сопоставляет продажи с покупками (лотами) для расчета реализованного
+// результата: по FIFO или по средней цене, отдельно для каждого инструмента и валюты.
+package lots
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrOversold - продано больше, чем было куплено к моменту продажи
+var ErrOversold = errors.New("sell quantity exceeds open lots")
+
+// Side - направление исполнения
+type Side int
+
+const (
+	Buy Side = iota
+	Sell
+)
+
+// Method - способ списания лотов при продаже
+type Method int
+
+const (
+	// FIFO списывает сначала самые ранние покупки
+	FIFO Method = iota
+	// AverageCost списывает по средней цене всех открытых лотов
+	AverageCost
+)
+
+// Fill - исполнение сделки: покупка или продажа количества инструмента по цене
+type Fill struct {
+	Instrument string
+	Currency   string
+	Side       Side
+	Quantity   decimal.Decimal
+	Price      decimal.Decimal
+	Date       time.Time
+}
+
+// Lot - оставшаяся часть покупки
+type Lot struct {
+	Instrument string
+	Currency   string
+	Quantity   decimal.Decimal
+	Price      decimal.Decimal
+	Date       time.Time
+}
+
+// Realization - продажа части позиции, сопоставленная с покупкой
+type Realization struct {
+	Instrument string
+	Currency   string
+	Quantity   decimal.Decimal
+	Proceeds   decimal.Decimal
+	Cost       decimal.Decimal
+	// Acquired - дата покупки лота. При средней цене нулевая: лоты усредняются
+	Acquired time.Time
+	Disposed time.Time
+}
+
+// Gain - реализованный результат: выручка минус стоимость покупки
+func (r Realization) Gain() decimal.Decimal {
+	return r.Proceeds.Sub(r.Cost)
+}
+
+// Summary - итоги реализаций по инструменту
+type Summary struct {
+	Instrument string
+	Currency   string
+	Quantity   decimal.Decimal
+	Proceeds   decimal.Decimal
+	Cost       decimal.Decimal
+	Gain       decimal.Decimal
+}
+
+type key struct {
+	instrument string
+	currency   string
+}
+
+// sortedFills возвращает копию исполнений по времени. В одно время покупки идут раньше продаж,
+// чтобы сделка, открытая и закрытая в одну секунду, не считалась продажей без покупки
+func sortedFills(fills []Fill) []Fill {
+	sorted := make([]Fill, len(fills))
+	copy(sorted, fills)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		return sorted[i].Side == Buy && sorted[j].Side == Sell
+	})
+
+	return sorted
+}
+
+// Match проходит исполнения в хронологическом порядке и возвращает реализации продаж
+// и оставшиеся открытые лоты. Исполнения с нулевым количеством пропускаются.
+func Match(fills []Fill, method Method) ([]Realization, []Lot, error) {
+	open := make(map[key][]Lot)
+	var order []key
+	var realized []Realization
+
+	for _, fill := range sortedFills(fills) {
+		if !fill.Quantity.IsPositive() {
+			continue
+		}
+
+		k := key{instrument: fill.Instrument, currency: fill.Currency}
+		if _, ok := open[k]; !ok {
+			order = append(order, k)
+		}
+
+		if fill.Side == Buy {
+			open[k] = append(open[k], Lot{Instrument: fill.Instrument, Currency: fill.Currency, Quantity: fill.Quantity, Price: fill.Price, Date: fill.Date})
+			continue
+		}
+
+		var matched []Realization
+		var err error
+		if method == AverageCost {
+			open[k], matched, err = sellAverage(open[k], fill)
+		} else {
+			open[k], matched, err = sellFIFO(open[k], fill)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		realized = append(realized, matched...)
+	}
+
+	var remaining []Lot
+	for _, k := range order {
+		remaining = append(remaining, open[k]...)
+	}
+
+	return realized, remaining, nil
+}
+
+func available(lots []Lot) decimal.Decimal {
+	total := decimal.Zero
+	for _, lot := range lots {
+		total = total.Add(lot.Quantity)
+	}
+
+	return total
+}
+
+func oversold(fill Fill, held decimal.Decimal) error {
+	return fmt.Errorf("%w: %s %s sold %s, held %s on %s", ErrOversold, fill.Instrument, fill.Currency,
+		fill.Quantity.String(), held.String(), fill.Date.Format(time.RFC3339))
+}
+
+// sellFIFO списывает продажу с самых ранних лотов, каждый лот дает отдельную реализацию
+func sellFIFO(lots []Lot, fill Fill) ([]Lot, []Realization, error) {
+	if held := available(lots); held.LessThan(fill.Quantity) {
+		return nil, nil, oversold(fill, held)
+	}
+
+	var realized []Realization
+	left := fill.Quantity
+	for left.IsPositive() {
+		lot := &lots[0]
+		quantity := decimal.Min(lot.Quantity, left)
+
+		realized = append(realized, Realization{
+			Instrument: fill.Instrument,
+			Currency:   fill.Currency,
+			Quantity:   quantity,
+			Proceeds:   quantity.Mul(fill.Price),
+			Cost:       quantity.Mul(lot.Price),
+			Acquired:   lot.Date,
+			Disposed:   fill.Date,
+		})
+
+		lot.Quantity = lot.Quantity.Sub(quantity)
+		left = left.Sub(quantity)
+		if lot.Quantity.IsZero() {
+			lots = lots[1:]
+		}
+	}
+
+	return lots, realized, nil
+}
+
+// sellAverage списывает продажу по средней цене открытых лотов. Оставшаяся позиция
+// сворачивается в один лот по той же средней цене с датой самой ранней покупки
+func sellAverage(lots []Lot, fill Fill) ([]Lot, []Realization, error) {
+	held := available(lots)
+	if held.LessThan(fill.Quantity) {
+		return nil, nil, oversold(fill, held)
+	}
+
+	totalCost := decimal.Zero
+	for _, lot := range lots {
+		totalCost = totalCost.Add(lot.Quantity.Mul(lot.Price))
+	}
+	average := totalCost.Div(held)
+
+	// Стоимость проданной части считаем долей от общей, чтобы при полном закрытии
+	// она точно совпала с суммой покупок без ошибки округления средней цены
+	cost := totalCost.Mul(fill.Quantity).Div(held)
+	realized := []Realization{{
+		Instrument: fill.Instrument,
+		Currency:   fill.Currency,
+		Quantity:   fill.Quantity,
+		Proceeds:   fill.Quantity.Mul(fill.Price),
+		Cost:       cost,
+		Disposed:   fill.Date,
+	}}
+
+	rest := held.Sub(fill.Quantity)
+	if rest.IsZero() {
+		return nil, realized, nil
+	}
+
+	return []Lot{{Instrument: fill.Instrument, Currency: fill.Currency, Quantity: rest, Price: average, Date: lots[0].Date}}, realized, nil
+}
+
+// Summarize складывает реализации по инструменту и валюте, результат отсортирован по валюте и инструменту
+func Summarize(realized []Realization) []Summary {
+	totals := make(map[key]*Summary)
+	for _, r := range realized {
+		k := key{instrument: r.Instrument, currency: r.Currency}
+		s := totals[k]
+		if s == nil {
+			s = &Summary{Instrument: r.Instrument, Currency: r.Currency}
+			totals[k] = s
+		}
+
+		s.Quantity = s.Quantity.Add(r.Quantity)
+		s.Proceeds = s.Proceeds.Add(r.Proceeds)
+		s.Cost = s.Cost.Add(r.Cost)
+		s.Gain = s.Gain.Add(r.Gain())
+	}
+
+	summaries := make([]Summary, 0, len(totals))
+	for _, s := range totals {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Currency != summaries[j].Currency {
+			return summaries[i].Currency < summaries[j].Currency
+		}
+		return summaries[i].Instrument < summaries[j].Instrument
+	})
+
+	return summaries
+}
@@ -0,0 +1,267 @@
+package lots
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// tradingDay возвращает дату исполнения на n-й торговый день от начала теста
+func tradingDay(n int) time.Time {
+	return time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC).AddDate(0, 0, n)
+}
+
+func d(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+func fill(side Side, instrument, currency, quantity, price string, day int) Fill {
+	return Fill{Instrument: instrument, Currency: currency, Side: side, Quantity: d(quantity), Price: d(price), Date: tradingDay(day)}
+}
+
+func buy(instrument string, quantity, price string, day int) Fill {
+	return fill(Buy, instrument, "USD", quantity, price, day)
+}
+
+func sell(instrument string, quantity, price string, day int) Fill {
+	return fill(Sell, instrument, "USD", quantity, price, day)
+}
+
+type wantRealization struct {
+	quantity, proceeds, cost, gain string
+	acquired                       int // день покупки, -1 - без даты покупки
+}
+
+func checkRealizations(t *testing.T, got []Realization, want []wantRealization) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d realizations, want %d: %+v", len(got), len(want), got)
+	}
+
+	for i, w := range want {
+		r := got[i]
+		if !r.Quantity.Equal(d(w.quantity)) || !r.Proceeds.Equal(d(w.proceeds)) || !r.Cost.Equal(d(w.cost)) || !r.Gain().Equal(d(w.gain)) {
+			t.Errorf("realization %d = qty %s proceeds %s cost %s gain %s, want qty %s proceeds %s cost %s gain %s",
+				i, r.Quantity, r.Proceeds, r.Cost, r.Gain(), w.quantity, w.proceeds, w.cost, w.gain)
+		}
+
+		acquired := time.Time{}
+		if w.acquired >= 0 {
+			acquired = tradingDay(w.acquired)
+		}
+		if !r.Acquired.Equal(acquired) {
+			t.Errorf("realization %d acquired %v, want %v", i, r.Acquired, acquired)
+		}
+	}
+}
+
+func TestMatchFIFO(t *testing.T) {
+	tests := []struct {
+		name  string
+		fills []Fill
+		want  []wantRealization
+		open  []string // количество в оставшихся лотах по порядку
+	}{
+		{
+			name:  "no sells",
+			fills: []Fill{buy("BTC", "1", "100", 0), buy("BTC", "2", "110", 1)},
+			open:  []string{"1", "2"},
+		},
+		{
+			name:  "single round trip",
+			fills: []Fill{buy("BTC", "1", "100", 0), sell("BTC", "1", "150", 1)},
+			want:  []wantRealization{{"1", "150", "100", "50", 0}},
+		},
+		{
+			name:  "sell spans two lots",
+			fills: []Fill{buy("BTC", "1", "100", 0), buy("BTC", "1", "200", 1), sell("BTC", "1.5", "300", 2)},
+			want: []wantRealization{
+				{"1", "300", "100", "200", 0},
+				{"0.5", "150", "100", "50", 1},
+			},
+			open: []string{"0.5"},
+		},
+		{
+			name:  "partial sells from one lot",
+			fills: []Fill{buy("ETH", "10", "10", 0), sell("ETH", "3", "12", 1), sell("ETH", "3", "8", 2)},
+			want: []wantRealization{
+				{"3", "36", "30", "6", 0},
+				{"3", "24", "30", "-6", 0},
+			},
+			open: []string{"4"},
+		},
+		{
+			name:  "unsorted input is matched by date",
+			fills: []Fill{sell("BTC", "1", "150", 2), buy("BTC", "1", "120", 1), buy("BTC", "1", "100", 0)},
+			want:  []wantRealization{{"1", "150", "100", "50", 0}},
+			open:  []string{"1"},
+		},
+		{
+			name:  "buy and sell at the same time",
+			fills: []Fill{sell("BTC", "1", "110", 0), buy("BTC", "1", "100", 0)},
+			want:  []wantRealization{{"1", "110", "100", "10", 0}},
+		},
+		{
+			name:  "instruments are matched separately",
+			fills: []Fill{buy("BTC", "1", "100", 0), buy("ETH", "1", "10", 1), sell("ETH", "1", "20", 2), sell("BTC", "1", "90", 3)},
+			want: []wantRealization{
+				{"1", "20", "10", "10", 1},
+				{"1", "90", "100", "-10", 0},
+			},
+		},
+		{
+			name:  "zero quantity is skipped",
+			fills: []Fill{buy("BTC", "0", "100", 0), sell("BTC", "0", "100", 1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realized, open, err := Match(tt.fills, FIFO)
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+
+			checkRealizations(t, realized, tt.want)
+
+			if len(open) != len(tt.open) {
+				t.Fatalf("got %d open lots, want %d: %+v", len(open), len(tt.open), open)
+			}
+			for i, quantity := range tt.open {
+				if !open[i].Quantity.Equal(d(quantity)) {
+					t.Errorf("open lot %d quantity %s, want %s", i, open[i].Quantity, quantity)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchCurrenciesAreSeparate(t *testing.T) {
+	fills := []Fill{
+		fill(Buy, "BTC", "USD", "1", "100", 0),
+		fill(Buy, "BTC", "EUR", "1", "90", 1),
+		fill(Sell, "BTC", "EUR", "1", "95", 2),
+	}
+
+	realized, open, err := Match(fills, FIFO)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+
+	// Продажа за евро не должна списать более раннюю покупку за доллары
+	if len(realized) != 1 || realized[0].Currency != "EUR" || !realized[0].Gain().Equal(d("5")) {
+		t.Errorf("realized = %+v, want one EUR realization with gain 5", realized)
+	}
+	if len(open) != 1 || open[0].Currency != "USD" {
+		t.Errorf("open = %+v, want one USD lot", open)
+	}
+}
+
+func TestMatchAverageCost(t *testing.T) {
+	fills := []Fill{
+		buy("BTC", "1", "100", 0),
+		buy("BTC", "1", "200", 1),
+		sell("BTC", "1", "180", 2),
+		buy("BTC", "2", "120", 3),
+		sell("BTC", "3", "150", 4),
+	}
+
+	realized, open, err := Match(fills, AverageCost)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+
+	// Средняя 150, после продажи остается 1 по 150, докупка 2 по 120 дает среднюю 130
+	checkRealizations(t, realized, []wantRealization{
+		{"1", "180", "150", "30", -1},
+		{"3", "450", "390", "60", -1},
+	})
+	if len(open) != 0 {
+		t.Errorf("open = %+v, want no lots", open)
+	}
+}
+
+func TestMatchAverageCostRemainder(t *testing.T) {
+	fills := []Fill{buy("BTC", "1", "100", 0), buy("BTC", "2", "100.3", 1), sell("BTC", "1", "120", 2)}
+
+	realized, open, err := Match(fills, AverageCost)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+
+	checkRealizations(t, realized, []wantRealization{{"1", "120", "100.2", "19.8", -1}})
+	if len(open) != 1 || !open[0].Quantity.Equal(d("2")) || !open[0].Price.Equal(d("100.2")) || !open[0].Date.Equal(tradingDay(0)) {
+		t.Errorf("open = %+v, want 2 at 100.2 from day 0", open)
+	}
+}
+
+func TestMatchAverageCostFullCloseKeepsExactCost(t *testing.T) {
+	// Средняя цена 100/3 не представима точно, но при полном закрытии стоимость должна совпасть с суммой покупок
+	fills := []Fill{buy("BTC", "1", "30", 0), buy("BTC", "1", "30", 1), buy("BTC", "1", "40", 2), sell("BTC", "3", "50", 3)}
+
+	realized, _, err := Match(fills, AverageCost)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+
+	checkRealizations(t, realized, []wantRealization{{"3", "150", "100", "50", -1}})
+}
+
+func TestMatchOversold(t *testing.T) {
+	for _, method := range []Method{FIFO, AverageCost} {
+		fills := []Fill{buy("BTC", "1", "100", 0), sell("BTC", "2", "150", 1)}
+
+		if _, _, err := Match(fills, method); !errors.Is(err, ErrOversold) {
+			t.Errorf("method %d: Match() error = %v, want ErrOversold", method, err)
+		}
+	}
+
+	// Продажа раньше покупки тоже недопустима
+	fills := []Fill{sell("BTC", "1", "150", 0), buy("BTC", "1", "100", 1)}
+	if _, _, err := Match(fills, FIFO); !errors.Is(err, ErrOversold) {
+		t.Errorf("sell before buy: Match() error = %v, want ErrOversold", err)
+	}
+}
+
+func TestMatchDoesNotModifyInput(t *testing.T) {
+	fills := []Fill{sell("BTC", "1", "150", 1), buy("BTC", "2", "100", 0)}
+
+	if _, _, err := Match(fills, FIFO); err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+
+	if fills[0].Side != Sell || !fills[1].Quantity.Equal(d("2")) {
+		t.Errorf("input fills changed: %+v", fills)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	realized := []Realization{
+		{Instrument: "ETH", Currency: "USD", Quantity: d("1"), Proceeds: d("20"), Cost: d("10")},
+		{Instrument: "BTC", Currency: "USD", Quantity: d("1"), Proceeds: d("90"), Cost: d("100")},
+		{Instrument: "BTC", Currency: "USD", Quantity: d("0.5"), Proceeds: d("60"), Cost: d("50")},
+		{Instrument: "BTC", Currency: "EUR", Quantity: d("1"), Proceeds: d("95"), Cost: d("90")},
+	}
+
+	got := Summarize(realized)
+
+	want := []Summary{
+		{Instrument: "BTC", Currency: "EUR", Quantity: d("1"), Proceeds: d("95"), Cost: d("90"), Gain: d("5")},
+		{Instrument: "BTC", Currency: "USD", Quantity: d("1.5"), Proceeds: d("150"), Cost: d("150"), Gain: d("0")},
+		{Instrument: "ETH", Currency: "USD", Quantity: d("1"), Proceeds: d("20"), Cost: d("10"), Gain: d("10")},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d summaries, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Instrument != w.Instrument || g.Currency != w.Currency || !g.Quantity.Equal(w.Quantity) ||
+			!g.Proceeds.Equal(w.Proceeds) || !g.Cost.Equal(w.Cost) || !g.Gain.Equal(w.Gain) {
+			t.Errorf("summary %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
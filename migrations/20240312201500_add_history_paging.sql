@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Users ADD COLUMN history_page_size INT NOT NULL DEFAULT 3;
+
+CREATE INDEX deals_user_date_idx ON Deals (user_id, deal_date DESC, deal_id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX deals_user_date_idx;
+
+ALTER TABLE Users DROP COLUMN history_page_size;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Strategies (
+                       strategy_id SERIAL PRIMARY KEY,
+                       user_id BIGINT REFERENCES Users(chat_id),
+                       name TEXT NOT NULL,
+                       UNIQUE (user_id, name)
+);
+
+ALTER TABLE Deals
+    ADD COLUMN note TEXT,
+    ADD COLUMN strategy_id INT REFERENCES Strategies(strategy_id),
+    ADD COLUMN execution_rating SMALLINT CHECK (execution_rating BETWEEN 1 AND 5),
+    ADD COLUMN emotion TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Deals
+    DROP COLUMN emotion,
+    DROP COLUMN execution_rating,
+    DROP COLUMN strategy_id,
+    DROP COLUMN note;
+
+DROP TABLE Strategies;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Strategies ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE StrategyRules (
+                       rule_id SERIAL PRIMARY KEY,
+                       strategy_id INT REFERENCES Strategies(strategy_id) ON DELETE CASCADE,
+                       position INT NOT NULL,
+                       text TEXT NOT NULL
+);
+
+CREATE TABLE DealRuleChecks (
+                       deal_id INT REFERENCES Deals(deal_id) ON DELETE CASCADE,
+                       rule_id INT REFERENCES StrategyRules(rule_id) ON DELETE CASCADE,
+                       followed BOOLEAN NOT NULL,
+                       PRIMARY KEY (deal_id, rule_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE DealRuleChecks;
+DROP TABLE StrategyRules;
+
+ALTER TABLE Strategies DROP COLUMN description;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE DealAttachments (
+                       attachment_id SERIAL PRIMARY KEY,
+                       deal_id INT REFERENCES Deals(deal_id) ON DELETE CASCADE,
+                       file_id TEXT NOT NULL,
+                       kind TEXT NOT NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX deal_attachments_deal_idx ON DealAttachments (deal_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE DealAttachments;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Tags (
+                       tag_id SERIAL PRIMARY KEY,
+                       user_id BIGINT REFERENCES Users(chat_id),
+                       name TEXT NOT NULL,
+                       UNIQUE (user_id, name)
+);
+
+CREATE TABLE DealTags (
+                       deal_id INT REFERENCES Deals(deal_id) ON DELETE CASCADE,
+                       tag_id INT REFERENCES Tags(tag_id) ON DELETE CASCADE,
+                       PRIMARY KEY (deal_id, tag_id)
+);
+
+CREATE INDEX deal_tags_tag_idx ON DealTags (tag_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE DealTags;
+DROP TABLE Tags;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Deals
+    ADD COLUMN amount DECIMAL,
+    ADD COLUMN stop_loss DECIMAL,
+    ADD COLUMN take_profit DECIMAL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Deals
+    DROP COLUMN take_profit,
+    DROP COLUMN stop_loss,
+    DROP COLUMN amount;
+-- +goose StatementEnd
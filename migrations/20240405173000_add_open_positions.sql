@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Users ADD COLUMN balance DECIMAL;
+
+-- Открытые позиции хранятся в Deals без цены продажи
+CREATE INDEX deals_open_idx ON Deals (user_id) WHERE sell_price IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX deals_open_idx;
+
+ALTER TABLE Users DROP COLUMN balance;
+-- +goose StatementEnd
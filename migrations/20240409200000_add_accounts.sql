@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Accounts (
+                       account_id SERIAL PRIMARY KEY,
+                       user_id BIGINT REFERENCES Users(chat_id),
+                       name TEXT NOT NULL,
+                       starting_balance DECIMAL NOT NULL,
+                       created_at TIMESTAMP NOT NULL,
+                       UNIQUE (user_id, name)
+);
+
+-- Пополнения со знаком плюс, выводы со знаком минус
+CREATE TABLE CashFlows (
+                       cash_flow_id SERIAL PRIMARY KEY,
+                       account_id INT REFERENCES Accounts(account_id) ON DELETE CASCADE,
+                       amount DECIMAL NOT NULL,
+                       flow_date TIMESTAMP NOT NULL
+);
+
+ALTER TABLE Deals ADD COLUMN account_id INT REFERENCES Accounts(account_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Deals DROP COLUMN account_id;
+
+DROP TABLE CashFlows;
+DROP TABLE Accounts;
+-- +goose StatementEnd
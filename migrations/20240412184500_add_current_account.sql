@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Текущий портфель (счет) пользователя, NULL - все портфели
+ALTER TABLE Users ADD COLUMN current_account_id INT REFERENCES Accounts(account_id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Users DROP COLUMN current_account_id;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Users ADD COLUMN max_daily_loss DECIMAL;
+ALTER TABLE Users ADD COLUMN max_daily_trades INT;
+ALTER TABLE Users ADD COLUMN max_consecutive_losses INT;
+
+CREATE TABLE LimitBreaches (
+                       breach_id SERIAL PRIMARY KEY,
+                       user_id BIGINT REFERENCES Users(chat_id),
+                       limit_kind TEXT NOT NULL,
+                       deal_id INT REFERENCES Deals(deal_id) ON DELETE SET NULL,
+                       breach_date TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE LimitBreaches;
+
+ALTER TABLE Users DROP COLUMN max_consecutive_losses;
+ALTER TABLE Users DROP COLUMN max_daily_trades;
+ALTER TABLE Users DROP COLUMN max_daily_loss;
+-- +goose StatementEnd
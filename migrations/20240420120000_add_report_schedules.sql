@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Расписание отчетов, next_run хранится в UTC
+CREATE TABLE ReportSchedules (
+                       user_id BIGINT REFERENCES Users(chat_id),
+                       period TEXT NOT NULL,
+                       hour INT NOT NULL,
+                       next_run TIMESTAMP NOT NULL,
+                       PRIMARY KEY (user_id, period)
+);
+
+CREATE INDEX report_schedules_next_run_idx ON ReportSchedules (next_run);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE ReportSchedules;
+
+ALTER TABLE Users DROP COLUMN timezone;
+-- +goose StatementEnd
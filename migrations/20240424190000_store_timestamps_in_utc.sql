@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Раньше даты записывались в часовом поясе сервера. Считаем, что он совпадает
+-- с часовым поясом сессии базы, и переводим сохраненные даты в UTC.
+UPDATE Deals SET deal_date = deal_date AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+UPDATE Accounts SET created_at = created_at AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+UPDATE CashFlows SET flow_date = flow_date AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+UPDATE LimitBreaches SET breach_date = breach_date AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE Deals SET deal_date = deal_date AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+UPDATE Accounts SET created_at = created_at AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+UPDATE CashFlows SET flow_date = flow_date AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+UPDATE LimitBreaches SET breach_date = breach_date AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
+-- +goose StatementEnd
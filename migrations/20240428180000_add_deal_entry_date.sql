@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- deal_date - дата выхода из сделки, entry_date - дата входа. У старых закрытых сделок вход неизвестен
+ALTER TABLE Deals ADD COLUMN entry_date TIMESTAMP;
+
+UPDATE Deals SET entry_date = deal_date WHERE sell_price IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Deals DROP COLUMN entry_date;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ценовые уведомления, triggered_at заполняется при срабатывании
+CREATE TABLE PriceAlerts (
+                       alert_id BIGSERIAL PRIMARY KEY,
+                       user_id BIGINT REFERENCES Users(chat_id),
+                       pair TEXT NOT NULL,
+                       direction TEXT NOT NULL,
+                       level DECIMAL NOT NULL,
+                       created_at TIMESTAMP NOT NULL,
+                       triggered_at TIMESTAMP
+);
+
+CREATE INDEX price_alerts_active_idx ON PriceAlerts (user_id) WHERE triggered_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE PriceAlerts;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Уведомления о достижении стопа или тейка открытой позиции, чтобы не присылать их повторно
+CREATE TABLE LevelHits (
+                       deal_id INT REFERENCES Deals(deal_id) ON DELETE CASCADE,
+                       level TEXT NOT NULL,
+                       price DECIMAL NOT NULL,
+                       hit_date TIMESTAMP NOT NULL,
+                       PRIMARY KEY (deal_id, level)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE LevelHits;
+-- +goose StatementEnd
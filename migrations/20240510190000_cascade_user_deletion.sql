@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Удаление пользователя удаляет все его данные
+ALTER TABLE UserPairs DROP CONSTRAINT userpairs_user_id_fkey,
+    ADD CONSTRAINT userpairs_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE Deals DROP CONSTRAINT deals_user_id_fkey,
+    ADD CONSTRAINT deals_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE Strategies DROP CONSTRAINT strategies_user_id_fkey,
+    ADD CONSTRAINT strategies_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE Tags DROP CONSTRAINT tags_user_id_fkey,
+    ADD CONSTRAINT tags_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE Accounts DROP CONSTRAINT accounts_user_id_fkey,
+    ADD CONSTRAINT accounts_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE LimitBreaches DROP CONSTRAINT limitbreaches_user_id_fkey,
+    ADD CONSTRAINT limitbreaches_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE ReportSchedules DROP CONSTRAINT reportschedules_user_id_fkey,
+    ADD CONSTRAINT reportschedules_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+ALTER TABLE PriceAlerts DROP CONSTRAINT pricealerts_user_id_fkey,
+    ADD CONSTRAINT pricealerts_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE UserPairs DROP CONSTRAINT userpairs_user_id_fkey,
+    ADD CONSTRAINT userpairs_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE Deals DROP CONSTRAINT deals_user_id_fkey,
+    ADD CONSTRAINT deals_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE Strategies DROP CONSTRAINT strategies_user_id_fkey,
+    ADD CONSTRAINT strategies_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE Tags DROP CONSTRAINT tags_user_id_fkey,
+    ADD CONSTRAINT tags_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE Accounts DROP CONSTRAINT accounts_user_id_fkey,
+    ADD CONSTRAINT accounts_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE LimitBreaches DROP CONSTRAINT limitbreaches_user_id_fkey,
+    ADD CONSTRAINT limitbreaches_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE ReportSchedules DROP CONSTRAINT reportschedules_user_id_fkey,
+    ADD CONSTRAINT reportschedules_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+ALTER TABLE PriceAlerts DROP CONSTRAINT pricealerts_user_id_fkey,
+    ADD CONSTRAINT pricealerts_user_id_fkey FOREIGN KEY (user_id) REFERENCES Users(chat_id);
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Нарушение лимита записывается не чаще раза в день пользователя
+ALTER TABLE LimitBreaches ADD COLUMN breach_day DATE;
+
+UPDATE LimitBreaches AS b
+SET breach_day = (b.breach_date AT TIME ZONE 'UTC' AT TIME ZONE u.timezone)::DATE
+FROM Users AS u
+WHERE b.user_id = u.chat_id;
+
+UPDATE LimitBreaches SET breach_day = breach_date::DATE WHERE breach_day IS NULL;
+
+-- Повторные нарушения за день, записанные раньше, удаляем, оставляя первое
+DELETE FROM LimitBreaches AS b
+USING LimitBreaches AS earlier
+WHERE b.user_id = earlier.user_id AND b.limit_kind = earlier.limit_kind
+  AND b.breach_day = earlier.breach_day AND b.breach_id > earlier.breach_id;
+
+ALTER TABLE LimitBreaches ALTER COLUMN breach_day SET NOT NULL;
+
+CREATE UNIQUE INDEX limit_breaches_day_idx ON LimitBreaches (user_id, limit_kind, breach_day);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX limit_breaches_day_idx;
+
+ALTER TABLE LimitBreaches DROP COLUMN breach_day;
+-- +goose StatementEnd